@@ -1,25 +1,79 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"sort"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Exca-DK/webscraper/log"
 	"github.com/Exca-DK/webscraper/scraper"
 	"github.com/Exca-DK/webscraper/scraper/analytics"
+	"github.com/Exca-DK/webscraper/scraper/cluster"
+	"github.com/Exca-DK/webscraper/scraper/control"
+	"github.com/Exca-DK/webscraper/scraper/graph"
+	"github.com/Exca-DK/webscraper/scraper/linkcheck"
 )
 
 var (
-	threadsFlag = flag.Int("threads", 1, "specifies how many threads the scraper should utilize for scrapping content.")
-	urlsFlag    = flag.String("urls", "", "Comma separated list of urls to scrape, eg. --urls=https://www.golang-book.com/books/intro/1,https://www.golang-book.com/books/intro/2")
-	lvlFlag     = flag.String("verbosity", log.Info.String(), fmt.Sprintf("specifies the logger output lvl. possible options are: %v", log.Lvls()))
+	threadsFlag    = flag.Int("threads", 1, "specifies how many threads the scraper should utilize for scrapping content.")
+	urlsFlag       = flag.String("urls", "", "Comma separated list of urls to scrape, eg. --urls=https://www.golang-book.com/books/intro/1,https://www.golang-book.com/books/intro/2")
+	lvlFlag        = flag.String("verbosity", log.Info.String(), fmt.Sprintf("specifies the logger output lvl. possible options are: %v", log.Lvls()))
+	backlogFlag    = flag.Int("backlog", 0, "specifies the maximum amount of urls waiting for scraping. 0 means unbounded.")
+	hostFlag       = flag.Int("host-threads", 0, "specifies the maximum amount of concurrent scrapes of a single host. 0 means unlimited.")
+	adaptiveFlag   = flag.Bool("adaptive", false, "enables adaptive concurrency, adjusting threads between 1 and --max-threads based on latency, errors and throttling.")
+	maxThreadsFlag = flag.Int("max-threads", 32, "specifies the upper bound of threads used by --adaptive.")
+	latencyFlag    = flag.Duration("target-latency", 2*time.Second, "specifies the fetch latency above which --adaptive decreases the concurrency.")
+	stateFlag      = flag.String("state", "", "path of the file used for checkpointing the crawl state. Checkpoints are disabled if empty.")
+	checkpointFlag = flag.Duration("checkpoint", 30*time.Second, "specifies how often the crawl state is checkpointed.")
+	controlFlag    = flag.String("control", "", "address of the control api used for throttling a live crawl, eg. --control=localhost:8080. Disabled if empty.")
+	resumeFlag     = flag.Bool("resume", false, "continues the interrupted crawl from the --state file.")
+	maxPagesFlag   = flag.Int("max-pages", 0, "specifies the maximum amount of pages fetched by the crawl. 0 means unlimited.")
+	maxBytesFlag   = flag.Int64("max-bytes", 0, "specifies the maximum amount of bytes downloaded by the crawl. 0 means unlimited.")
+	maxTimeFlag    = flag.Duration("max-duration", 0, "specifies the maximum duration of the crawl. 0 means unlimited.")
+	maxErrorsFlag  = flag.Int("max-errors", 0, "specifies the maximum amount of consecutive failed fetches of the crawl. 0 means unlimited.")
+	hostPagesFlag  = flag.Int("host-max-pages", 0, "specifies the maximum amount of pages fetched from a single host. 0 means unlimited.")
+	hostBytesFlag  = flag.Int64("host-max-bytes", 0, "specifies the maximum amount of bytes downloaded from a single host. 0 means unlimited.")
+	hostErrorsFlag = flag.Int("host-max-errors", 0, "specifies the maximum amount of consecutive failed fetches of a single host. 0 means unlimited.")
+	attemptsFlag   = flag.Int("max-attempts", 1, "specifies how many times a url is fetched before it's recorded as a dead letter.")
+	deadFlag       = flag.String("dead-letters", "", "path of the file keeping urls that failed permanently. Kept only in memory if empty.")
+	nodeFlag       = flag.String("node", "", "address of the cluster api, eg. --node=10.0.0.1:9000. Enables the distributed crawl following the links until interrupted.")
+	nodeIDFlag     = flag.String("node-id", "", "specifies the id of the cluster node. Defaults to the --node address.")
+	graphFlag      = flag.String("graph", "", "path of the file the link graph of the crawl is exported to. Disabled if empty.")
+	graphFmtFlag   = flag.String("graph-format", "dot", "format of the exported link graph, one of dot, graphml or csv.")
+	robotsFlag     = flag.Bool("robots", false, "honors the noindex and nofollow directives of the meta robots tags and X-Robots-Tag headers, rel=nofollow links and canonical urls of the pages.")
+	trapsFlag      = flag.Bool("traps", false, "detects crawler traps, eg. calendars, faceted search or session ids in urls, and drops the urls falling into them.")
+	contentFlag    = flag.Bool("dedup-content", false, "analyzes byte-identical pages served by different urls once, ignoring differences in whitespace.")
+	nearDupFlag    = flag.Bool("skip-near-duplicates", false, "skips the analysis and links of pages whose text near-duplicates a page already scraped, eg. mirrors or printer-friendly variants.")
+	nearDistFlag   = flag.Int("near-duplicate-distance", scraper.DefaultNearDuplicateThreshold, "specifies the maximum Hamming distance of the SimHash fingerprints of near-duplicate pages.")
+	breakerFlag    = flag.Int("breaker-failures", 0, "specifies the consecutive failed fetches of a host opening its circuit breaker, parking its urls. 0 disables the breakers.")
+	cooldownFlag   = flag.Duration("breaker-cooldown", time.Minute, "specifies how long an open circuit breaker parks the urls of its host before probing it again.")
+	timeoutFlag    = flag.Duration("fetch-timeout", scraper.DefaultFetchTimeout, "specifies how long a single fetch may take before it fails.")
+	joinFlag       = flag.String("join", "", "url of the coordinator joined by the cluster node, eg. --join=http://10.0.0.1:9000. The node is the coordinator if empty.")
 )
 
+const usage = `Usage:
+  webscraper [flags]
+  webscraper [flags] deadletters list
+  webscraper [flags] deadletters export [--format=json|csv] [--out=path]
+  webscraper [flags] deadletters resubmit
+  webscraper [flags] check-links [--format=text|json] [--out=path]
+
+Flags:
+`
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	var logLvl log.LogLvl
 	if err := logLvl.FromString(*lvlFlag); err != nil {
@@ -29,37 +83,363 @@ func main() {
 	logger := log.NewLogger(logLvl, os.Stdout)
 
 	urls := strings.Split(*urlsFlag, ",")
+	// urls failed in the previous runs, scraped instead of --urls
+	var resubmit bool
+	// arguments of the check-links command, nil if not running it
+	var checkArgs []string
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "deadletters":
+			urls, resubmit = deadLetters(args[1:]), true
+		case "check-links":
+			checkArgs = args[1:]
+		default:
+			fmt.Printf("unknown command %q\n", args[0])
+			os.Exit(1)
+		}
+	}
 	threads := *threadsFlag
 	if threads < 1 {
 		threads = 1
 	}
+	if *graphFmtFlag != "dot" && *graphFmtFlag != "graphml" && *graphFmtFlag != "csv" {
+		fmt.Printf("unknown --graph-format %q\n", *graphFmtFlag)
+		os.Exit(1)
+	}
+	if *resumeFlag && *stateFlag == "" {
+		fmt.Println("--resume requires --state")
+		os.Exit(1)
+	}
 	logger.Info("Initializing scrapper.", "threads:", threads, "urls:", urls)
-	scrapper := scraper.NewScrapper(logger).WithThreads(threads)
+	scrapper := scraper.NewScrapper(logger).WithThreads(threads).WithMaxBacklog(*backlogFlag).WithHostConcurrency(*hostFlag).
+		WithBudget(scraper.Budget{MaxPages: *maxPagesFlag, MaxBytes: *maxBytesFlag, MaxDuration: *maxTimeFlag, MaxConsecutiveErrors: *maxErrorsFlag}).
+		WithHostBudget(scraper.Budget{MaxPages: *hostPagesFlag, MaxBytes: *hostBytesFlag, MaxConsecutiveErrors: *hostErrorsFlag}).
+		WithMaxAttempts(*attemptsFlag).WithFetchTimeout(*timeoutFlag)
+	if *robotsFlag {
+		scrapper = scrapper.WithRobots(scraper.RobotsConfig{Noindex: true, Nofollow: true, Canonical: true})
+	}
+	if *trapsFlag {
+		scrapper = scrapper.WithTrapDetection(scraper.DefaultTrapConfig)
+	}
+	if *breakerFlag > 0 {
+		scrapper = scrapper.WithCircuitBreaker(scraper.BreakerConfig{FailureThreshold: *breakerFlag, Cooldown: *cooldownFlag})
+	}
+	if *contentFlag {
+		scrapper = scrapper.WithContentDedup()
+	}
+	if *nearDupFlag {
+		scrapper = scrapper.WithNearDuplicates(scraper.NearDuplicateConfig{Threshold: *nearDistFlag, Skip: true})
+	}
+	if *deadFlag != "" {
+		scrapper = scrapper.WithDeadLetters(scraper.NewFileDeadLetterStore(*deadFlag))
+	}
+	if *adaptiveFlag {
+		// hosts without a limit adapt up to the threads
+		maxHostLimit := *hostFlag
+		if maxHostLimit == 0 {
+			maxHostLimit = *maxThreadsFlag
+		}
+		scrapper = scrapper.WithAdaptiveConcurrency(scraper.AdaptiveConfig{
+			MinThreads:    1,
+			MaxThreads:    *maxThreadsFlag,
+			MinHostLimit:  1,
+			MaxHostLimit:  maxHostLimit,
+			TargetLatency: *latencyFlag,
+			MaxErrorRate:  0.5,
+		})
+	}
+
+	analyzers := make(map[string]*analytics.WordFrequencyAnalyzer)
+	if *stateFlag != "" {
+		store := scraper.NewFileStateStore(*stateFlag)
+		scrapper = scrapper.WithStateStore(store, *checkpointFlag)
+		if *resumeFlag {
+			urls = resume(logger, scrapper, store, urls, analyzers)
+		}
+	}
 	scrapper.Start()
 	defer scrapper.Stop()
 
-	analyzers := make(map[string]*analytics.WordFrequencyAnalyzer)
+	if *controlFlag != "" {
+		logger.Info("Starting control api.", "address:", *controlFlag)
+		go func() {
+			if err := http.ListenAndServe(*controlFlag, control.NewHandler(scrapper)); err != nil {
+				logger.Warn("Control api stopped.", "err:", err.Error())
+			}
+		}()
+	}
+
+	if checkArgs != nil {
+		code := checkLinks(scrapper, urls, checkArgs)
+		// os.Exit skips the deferred calls
+		scrapper.Stop()
+		os.Exit(code)
+	}
+
+	var links *graph.Graph
+	if *graphFlag != "" {
+		links = graph.New()
+	}
+	if *nodeFlag != "" {
+		runNode(logger, scrapper, urls, links)
+		return
+	}
+
+	// urls restored from the state are already queued by the scrapper
+	queued := make(map[string]struct{}, len(analyzers))
+	for url := range analyzers {
+		queued[url] = struct{}{}
+	}
 	for _, url := range urls {
+		if _, ok := analyzers[url]; ok {
+			continue
+		}
 		analyzers[url] = analytics.NewWordFrequencyAnalyzer(1)
 	}
 
 	ts := time.Now()
-	var wg sync.WaitGroup
-	for key, value := range analyzers {
-		wg.Add(1)
-		url := key
-		analyzer := value
-		scrapper.Scrape(url, analyzer)
-		go func() {
-			result, err := analyzer.Result()
-			if err != nil {
-				logger.Warn("Scrape failed.", "url:", url, "err:", err.Error())
-			} else {
-				logger.Info("Scrape finished.", "url:", url, "result:", result)
+	for url, analyzer := range analyzers {
+		if _, ok := queued[url]; ok {
+			continue
+		}
+		var a analytics.Analyzer = analyzer
+		if links != nil {
+			links.AddRoot(url)
+			a = analytics.NewMultiAnalyzer(analyzer, links.Analyzer(url))
+		}
+		// the analyzer gets cancelled on failure, so the error is reported below
+		if resubmit {
+			scrapper.ResubmitDeadLetters(context.Background(), []string{url}, a)
+			continue
+		}
+		scrapper.Scrape(url, a)
+	}
+	// finish everything that is queued, including retries
+	scrapper.Drain(context.Background())
+
+	for url, analyzer := range analyzers {
+		result, err := analyzer.Result()
+		if err != nil {
+			logger.Warn("Scrape failed.", "url:", url, "err:", err.Error())
+		} else {
+			logger.Info("Scrape finished.", "url:", url, "result:", result)
+		}
+	}
+	report := scrapper.BudgetReport()
+	for host, usage := range report.Hosts {
+		logger.Info("Host budget.", "host:", host, "pages:", usage.Pages, "bytes:", usage.Bytes, "exceeded:", usage.Exceeded)
+	}
+	logger.Info("Scraping finished.", "duration:", time.Since(ts), "pages:", report.Crawl.Pages, "bytes:", report.Crawl.Bytes, "exceeded:", report.Crawl.Exceeded)
+	exportGraph(logger, links)
+}
+
+// exportGraph exports the link graph to the --graph file, unless it's nil.
+func exportGraph(logger log.Logger, links *graph.Graph) {
+	if links == nil {
+		return
+	}
+	f, err := os.Create(*graphFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := links.Export(f, *graphFmtFlag); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := f.Close(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	logger.Info("Link graph exported.", "path:", *graphFlag, "pages:", len(links.Pages()), "links:", len(links.Edges()), "orphans:", len(links.Orphans()))
+
+	ranks := links.PageRank(graph.RankConfig{IgnoreNofollow: true})
+	pages := links.Pages()
+	sort.SliceStable(pages, func(i, j int) bool { return ranks[pages[i]] > ranks[pages[j]] })
+	for _, url := range pages[:min(len(pages), 10)] {
+		logger.Info("Top ranked page.", "url:", url, "pagerank:", ranks[url], "inbound:", len(links.Inbound(url)))
+	}
+}
+
+// runNode runs the scrapper as a node of a distributed crawl until the process is interrupted.
+// Links of the pages scraped by the node are captured in the graph, unless it's nil.
+func runNode(logger log.Logger, scrapper *scraper.Scrapper, urls []string, links *graph.Graph) {
+	id := *nodeIDFlag
+	if id == "" {
+		id = *nodeFlag
+	}
+	node := cluster.NewNode(cluster.Member{ID: id, Addr: "http://" + *nodeFlag}, scrapper, logger).WithFollowLinks(true)
+	if links != nil {
+		node = node.WithAnalyzers(links.Analyzer)
+	}
+	defer node.Close()
+	logger.Info("Starting cluster node.", "id:", id, "address:", *nodeFlag)
+	go func() {
+		if err := http.ListenAndServe(*nodeFlag, node.Handler()); err != nil {
+			logger.Warn("Cluster api stopped.", "err:", err.Error())
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *joinFlag != "" {
+		if err := node.Join(ctx, *joinFlag); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		logger.Info("Joined cluster.", "coordinator:", *joinFlag, "members:", len(node.Membership().Members))
+	}
+	seeds := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if url != "" {
+			seeds = append(seeds, url)
+		}
+	}
+	// not bound to ctx, so that the pending urls are still handed over on leave
+	if err := node.Submit(context.Background(), seeds); err != nil {
+		logger.Warn("Failed submitting urls.", "err:", err.Error())
+	}
+
+	<-ctx.Done()
+	logger.Info("Stopping cluster node.", "id:", id)
+	if *joinFlag != "" {
+		if err := node.Leave(context.Background()); err != nil {
+			logger.Warn("Failed leaving cluster.", "err:", err.Error())
+		}
+	}
+	stats := scrapper.Stats()
+	logger.Info("Cluster node stopped.", "id:", id, "backlog:", stats.Backlog, "inFlight:", stats.InFlight)
+	exportGraph(logger, links)
+}
+
+// resume restores the crawl state from the store into the scrapper.
+// The analyzers for restored urls are added to the analyzers map and
+// the urls that were already scraped in the previous run are removed from the returned urls.
+func resume(logger log.Logger, scrapper *scraper.Scrapper, store scraper.StateStore, urls []string, analyzers map[string]*analytics.WordFrequencyAnalyzer) []string {
+	snapshot, err := store.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("No crawl state to resume from.")
+		return urls
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for _, url := range snapshot.Pending() {
+		analyzers[url] = analytics.NewWordFrequencyAnalyzer(1)
+	}
+	scrapper.Resume(snapshot, func(url string) analytics.Analyzer { return analyzers[url] })
+
+	seen := make(map[string]struct{}, len(snapshot.Seen))
+	for _, entry := range snapshot.Seen {
+		seen[entry.URL] = struct{}{}
+	}
+	remaining := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if _, ok := seen[url]; ok {
+			continue
+		}
+		remaining = append(remaining, url)
+	}
+	return remaining
+}
+
+// checkLinks runs the check-links command, crawling the hosts of the urls and reporting their broken links.
+// It returns the exit code of the process, non-zero if there are broken links.
+func checkLinks(scrapper *scraper.Scrapper, urls []string, args []string) int {
+	flags := flag.NewFlagSet("check-links", flag.ExitOnError)
+	format := flags.String("format", "text", "format of the report, either text or json.")
+	out := flags.String("out", "", "path of the report file. Written to stdout if empty.")
+	flags.Parse(args)
+	if *format != "text" && *format != "json" {
+		fmt.Printf("unknown report format %q\n", *format)
+		return 2
+	}
+
+	report, err := linkcheck.Check(context.Background(), scrapper, urls, linkcheck.Config{})
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	if err := writeReport(report, *format, *out); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	if len(report.Broken) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// writeReport writes the report of the link check to the file under the path, or to stdout if the path is empty.
+func writeReport(report linkcheck.Report, format, path string) error {
+	if path == "" {
+		return report.Write(os.Stdout, format)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// deadLetters runs the deadletters command. The list and export subcommands exit the process,
+// while resubmit returns the failed urls that should be scraped again.
+func deadLetters(args []string) []string {
+	if *deadFlag == "" {
+		fmt.Println("deadletters requires --dead-letters")
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		fmt.Println("deadletters requires one of list, export or resubmit")
+		os.Exit(1)
+	}
+	letters, err := scraper.NewFileDeadLetterStore(*deadFlag).List()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		for _, letter := range letters {
+			fmt.Printf("%s\tattempts: %d\tfailed: %s\terr: %s\n", letter.URL, letter.Attempts, letter.FailedAt.Format(time.RFC3339), letter.Err)
+		}
+		os.Exit(0)
+	case "export":
+		flags := flag.NewFlagSet("export", flag.ExitOnError)
+		format := flags.String("format", "json", "format of the export, either json or csv.")
+		out := flags.String("out", "", "path of the exported file. Written to stdout if empty.")
+		flags.Parse(args[1:])
+		w := os.Stdout
+		if *out != "" {
+			if w, err = os.Create(*out); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
 			}
-			wg.Done()
-		}()
+		}
+		if err := scraper.ExportDeadLetters(w, letters, *format); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := w.Close(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "resubmit":
+		urls := make([]string, len(letters))
+		for i, letter := range letters {
+			urls[i] = letter.URL
+		}
+		return urls
 	}
-	wg.Wait()
-	logger.Info("Scraping finished.", "duration:", time.Since(ts))
+	fmt.Printf("unknown deadletters command %q\n", args[0])
+	os.Exit(1)
+	return nil
 }
@@ -0,0 +1,185 @@
+package scraper
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/log"
+)
+
+// AdaptiveConfig configures the adaptive concurrency controller.
+// The controller follows AIMD: concurrency grows by one after every healthy interval
+// and is multiplied by Backoff after an interval with high latency, high error rate or throttling responses.
+type AdaptiveConfig struct {
+	MinThreads int // lower bound of worker threads
+	MaxThreads int // upper bound of worker threads
+
+	// Bounds of concurrent scrapes per host. Per host adaptation is disabled if MaxHostLimit is 0.
+	MinHostLimit int
+	MaxHostLimit int
+
+	TargetLatency time.Duration // average fetch latency above which the concurrency is decreased, 0 disables the check
+	MaxErrorRate  float64       // rate of failed fetches above which the concurrency is decreased, 0 disables the check
+	Backoff       float64       // multiplicative decrease factor, defaults to 0.5
+	Interval      time.Duration // how often the concurrency is adjusted, defaults to 5 seconds
+}
+
+// withDefaults returns the config with the missing values filled in.
+func (c AdaptiveConfig) withDefaults() AdaptiveConfig {
+	if c.MinThreads < 1 {
+		c.MinThreads = 1
+	}
+	if c.MaxThreads < c.MinThreads {
+		c.MaxThreads = c.MinThreads
+	}
+	if c.MaxHostLimit > 0 && c.MinHostLimit < 1 {
+		c.MinHostLimit = 1
+	}
+	if c.MaxHostLimit < c.MinHostLimit {
+		c.MaxHostLimit = c.MinHostLimit
+	}
+	if c.Backoff <= 0 || c.Backoff >= 1 {
+		c.Backoff = 0.5
+	}
+	if c.Interval <= 0 {
+		c.Interval = 5 * time.Second
+	}
+	return c
+}
+
+// fetchWindow aggregates fetch outcomes observed during a single interval.
+type fetchWindow struct {
+	fetches   int
+	errors    int
+	throttled int // 429 and 503 responses
+	latency   time.Duration
+}
+
+func (w *fetchWindow) add(latency time.Duration, statusCode int, err error) {
+	w.fetches++
+	w.latency += latency
+	if err != nil {
+		w.errors++
+	}
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		w.throttled++
+	}
+}
+
+// overloaded reports whether the window shows signs of overload, together with the reason.
+func (w *fetchWindow) overloaded(cfg AdaptiveConfig) (bool, string) {
+	if w.throttled > 0 {
+		return true, "throttled"
+	}
+	if cfg.MaxErrorRate > 0 && float64(w.errors)/float64(w.fetches) > cfg.MaxErrorRate {
+		return true, "errors"
+	}
+	if cfg.TargetLatency > 0 && w.latency/time.Duration(w.fetches) > cfg.TargetLatency {
+		return true, "latency"
+	}
+	return false, ""
+}
+
+// adaptiveTarget is the set of knobs adjusted by the controller.
+type adaptiveTarget interface {
+	SetThreads(num int)
+	Threads() int
+	setHostLimit(host string, limit int)
+	hostLimit(host string) int
+}
+
+// adaptiveController adjusts the concurrency of the target based on the observed fetches.
+type adaptiveController struct {
+	cfg    AdaptiveConfig
+	target adaptiveTarget
+	logger log.Logger
+
+	mu     sync.Mutex // mutex protecting windows
+	global fetchWindow
+	hosts  map[string]*fetchWindow
+}
+
+func newAdaptiveController(cfg AdaptiveConfig, target adaptiveTarget, logger log.Logger) *adaptiveController {
+	return &adaptiveController{
+		cfg:    cfg.withDefaults(),
+		target: target,
+		logger: logger,
+		hosts:  make(map[string]*fetchWindow),
+	}
+}
+
+// observe records the outcome of a single fetch.
+func (c *adaptiveController) observe(host string, latency time.Duration, statusCode int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.global.add(latency, statusCode, err)
+	window, ok := c.hosts[host]
+	if !ok {
+		window = &fetchWindow{}
+		c.hosts[host] = window
+	}
+	window.add(latency, statusCode, err)
+}
+
+// run adjusts the concurrency every interval until done is closed.
+func (c *adaptiveController) run(done <-chan struct{}) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.adjust()
+		}
+	}
+}
+
+// adjust applies the observations of the finished interval and starts a new one.
+func (c *adaptiveController) adjust() {
+	c.mu.Lock()
+	global, hosts := c.global, c.hosts
+	c.global, c.hosts = fetchWindow{}, make(map[string]*fetchWindow)
+	c.mu.Unlock()
+
+	// nothing observed, nothing to judge
+	if global.fetches > 0 {
+		current := c.target.Threads()
+		next, reason := c.next(current, c.cfg.MinThreads, c.cfg.MaxThreads, &global)
+		if next != current {
+			c.logger.Info("adaptive concurrency adjusted threads", "from:", current, "to:", next, "reason:", reason)
+			c.target.SetThreads(next)
+		}
+	}
+
+	if c.cfg.MaxHostLimit == 0 {
+		return
+	}
+	for host, window := range hosts {
+		current := c.target.hostLimit(host)
+		if current == 0 {
+			current = c.cfg.MaxHostLimit
+		}
+		next, reason := c.next(current, c.cfg.MinHostLimit, c.cfg.MaxHostLimit, window)
+		if next != c.target.hostLimit(host) {
+			c.logger.Info("adaptive concurrency adjusted host limit", "host:", host, "from:", current, "to:", next, "reason:", reason)
+			c.target.setHostLimit(host, next)
+		}
+	}
+}
+
+// next returns the concurrency following the current one for the observed window, bounded by min and max.
+func (c *adaptiveController) next(current, min, max int, window *fetchWindow) (int, string) {
+	next, reason := current+1, "healthy"
+	if overloaded, why := window.overloaded(c.cfg); overloaded {
+		next, reason = int(float64(current)*c.cfg.Backoff), why
+	}
+	if next < min {
+		next = min
+	}
+	if next > max {
+		next = max
+	}
+	return next, reason
+}
@@ -0,0 +1,139 @@
+package scraper
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/log"
+)
+
+type testingAdaptiveTarget struct {
+	threads int
+	limits  map[string]int
+}
+
+func (t *testingAdaptiveTarget) SetThreads(num int)                  { t.threads = num }
+func (t *testingAdaptiveTarget) Threads() int                        { return t.threads }
+func (t *testingAdaptiveTarget) setHostLimit(host string, limit int) { t.limits[host] = limit }
+func (t *testingAdaptiveTarget) hostLimit(host string) int           { return t.limits[host] }
+
+// TestAdaptiveController checks that the concurrency is increased additively while healthy
+// and decreased multiplicatively on overload, within the configured bounds.
+func TestAdaptiveController(t *testing.T) {
+	target := &testingAdaptiveTarget{threads: 4, limits: make(map[string]int)}
+	controller := newAdaptiveController(AdaptiveConfig{
+		MinThreads:    2,
+		MaxThreads:    5,
+		MinHostLimit:  1,
+		MaxHostLimit:  4,
+		TargetLatency: time.Second,
+		MaxErrorRate:  0.5,
+	}, target, log.NewLogger(log.Warn, io.Discard))
+
+	tests := []struct {
+		name     string
+		observe  func()
+		threads  int
+		fooLimit int
+		barLimit int
+	}{
+		{
+			name:     "idle",
+			observe:  func() {},
+			threads:  4,
+			fooLimit: 0,
+		},
+		{
+			name: "healthy",
+			observe: func() {
+				controller.observe("foo", time.Millisecond, http.StatusOK, nil)
+				controller.observe("bar", time.Millisecond, http.StatusOK, nil)
+			},
+			threads:  5,
+			fooLimit: 4,
+			barLimit: 4,
+		},
+		{
+			name: "upper bound",
+			observe: func() {
+				controller.observe("foo", time.Millisecond, http.StatusOK, nil)
+			},
+			threads:  5,
+			fooLimit: 4,
+			barLimit: 4,
+		},
+		{
+			name: "throttled host",
+			observe: func() {
+				controller.observe("foo", time.Millisecond, http.StatusTooManyRequests, nil)
+				controller.observe("bar", time.Millisecond, http.StatusOK, nil)
+			},
+			threads:  2,
+			fooLimit: 2,
+			barLimit: 4,
+		},
+		{
+			name: "errors",
+			observe: func() {
+				controller.observe("foo", time.Millisecond, 0, errors.New("foo"))
+			},
+			threads:  2,
+			fooLimit: 1,
+			barLimit: 4,
+		},
+		{
+			name: "latency",
+			observe: func() {
+				controller.observe("bar", 2*time.Second, http.StatusOK, nil)
+			},
+			threads:  2,
+			fooLimit: 1,
+			barLimit: 2,
+		},
+	}
+	for _, test := range tests {
+		test.observe()
+		controller.adjust()
+		if target.threads != test.threads {
+			t.Fatalf("%s: unexpected threads. got %v, want %v", test.name, target.threads, test.threads)
+		}
+		if target.limits["foo"] != test.fooLimit || target.limits["bar"] != test.barLimit {
+			t.Fatalf("%s: unexpected host limits. got %v", test.name, target.limits)
+		}
+	}
+}
+
+// TestHostLimiter checks that the concurrent scrapes are limited per host.
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(1)
+	limiter.setLimit("bar", 2)
+	if !limiter.acquire("foo") || limiter.acquire("foo") {
+		t.Fatal("default limit not respected")
+	}
+	if !limiter.acquire("bar") || !limiter.acquire("bar") || limiter.acquire("bar") {
+		t.Fatal("host limit not respected")
+	}
+	limiter.release("foo")
+	if !limiter.acquire("foo") {
+		t.Fatal("released slot not reusable")
+	}
+}
+
+// TestAdaptiveBounds checks that the scrapper starts within the bounds of the controller, regardless of the order of the options.
+func TestAdaptiveBounds(t *testing.T) {
+	scrapper := NewScrapper(log.NewLogger(log.Warn, io.Discard)).
+		WithAdaptiveConcurrency(AdaptiveConfig{MinThreads: 1, MaxThreads: 4, MaxHostLimit: 3}).
+		WithThreads(8).
+		WithHostConcurrency(0)
+	scrapper.Start()
+	defer scrapper.Stop()
+	if threads := scrapper.Threads(); threads != 4 {
+		t.Fatalf("unexpected threads %v", threads)
+	}
+	if limit := scrapper.hostLimit("example.com"); limit != 3 {
+		t.Fatalf("unexpected host limit %v", limit)
+	}
+}
@@ -75,3 +75,25 @@ func (analyzer *WordFrequencyAnalyzer) Result() ([]struct {
 	})
 	return arr, nil
 }
+
+// multiAnalyzer passes the page to several analyzers.
+type multiAnalyzer []Analyzer
+
+// NewMultiAnalyzer returns Analyzer that passes the page to all of the analyzers, in their order.
+func NewMultiAnalyzer(analyzers ...Analyzer) Analyzer {
+	return multiAnalyzer(analyzers)
+}
+
+// Implements Analyzer.Analyze
+func (m multiAnalyzer) Analyze(page string) {
+	for _, analyzer := range m {
+		analyzer.Analyze(page)
+	}
+}
+
+// Implements Analyzer.Cancel
+func (m multiAnalyzer) Cancel(err error) {
+	for _, analyzer := range m {
+		analyzer.Cancel(err)
+	}
+}
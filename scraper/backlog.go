@@ -0,0 +1,88 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+)
+
+// backlog keeps track of targets that were accepted by the scrapper but not yet handed over to the workers.
+// It limits the amount of such targets, making the producers wait until there is enough space for them.
+type backlog struct {
+	mu    sync.Mutex
+	size  int
+	limit int           // 0 means unbounded
+	freed chan struct{} // closed and replaced every time some space is freed
+}
+
+func newBacklog(limit int) *backlog {
+	return &backlog{limit: limit, freed: make(chan struct{})}
+}
+
+// tryReserve reserves space for n targets if it's available right now.
+func (b *backlog) tryReserve(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit != 0 && b.size+n > b.limit {
+		return false
+	}
+	b.size += n
+	return true
+}
+
+// reserve waits until there is space for n targets and reserves it.
+// Returns early with the error of whichever of ctx or stopped is done first.
+// n must not exceed the limit.
+func (b *backlog) reserve(ctx context.Context, stopped context.Context, n int) error {
+	for {
+		b.mu.Lock()
+		if b.limit == 0 || b.size+n <= b.limit {
+			b.size += n
+			b.mu.Unlock()
+			return nil
+		}
+		freed := b.freed
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stopped.Done():
+			return stopped.Err()
+		case <-freed:
+		}
+	}
+}
+
+// add unconditionally adds n targets, even if it exceeds the limit.
+func (b *backlog) add(n int) {
+	b.mu.Lock()
+	b.size += n
+	b.mu.Unlock()
+}
+
+// release frees space of n targets and wakes up the waiting producers.
+func (b *backlog) release(n int) {
+	if n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.size -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// len returns the amount of targets currently held in the backlog.
+func (b *backlog) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size
+}
+
+// chunk returns the biggest amount of targets that can be reserved at once.
+func (b *backlog) chunk(n int) int {
+	if b.limit != 0 && n > b.limit {
+		return b.limit
+	}
+	return n
+}
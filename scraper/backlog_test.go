@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestBacklog checks that the backlog limits reservations and wakes up the waiting producers once space is freed.
+func TestBacklog(t *testing.T) {
+	b := newBacklog(2)
+	if !b.tryReserve(2) {
+		t.Fatal("failed reserving free space")
+	}
+	if b.tryReserve(1) {
+		t.Fatal("reserved more than the limit")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.reserve(ctx, context.Background(), 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error. got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	reserved := make(chan error)
+	go func() { reserved <- b.reserve(context.Background(), context.Background(), 2) }()
+	b.release(1)
+	b.release(1)
+	if err := <-reserved; err != nil {
+		t.Fatal(err)
+	}
+	if b.len() != 2 {
+		t.Fatalf("unexpected backlog size. got %v, want %v", b.len(), 2)
+	}
+	if b.chunk(5) != 2 {
+		t.Fatalf("unexpected chunk size. got %v, want %v", b.chunk(5), 2)
+	}
+}
+
+// TestScrapeBackpressure checks that a full backlog makes TryScrape fail and Scrape wait for space.
+func TestScrapeBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1).WithMaxBacklog(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+	defer close(release)
+
+	// first one occupies the only worker, the second one the whole backlog
+	for _, path := range []string{"/1", "/2"} {
+		if _, err := scrapper.Scrape(server.URL+path, &testingCallbackAnalyzer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := scrapper.TryScrape(server.URL+"/3", &testingCallbackAnalyzer{}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrQueueFull)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cancelled := &testingCallbackAnalyzer{}
+	if _, err := scrapper.ScrapeContext(ctx, server.URL+"/4", cancelled); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error. got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !errors.Is(cancelled.err, context.DeadlineExceeded) {
+		t.Fatalf("analyzer not cancelled. got %v, want %v", cancelled.err, context.DeadlineExceeded)
+	}
+
+	if stats := scrapper.Stats(); stats.Backlog != 1 || stats.Capacity != 1 {
+		t.Fatalf("unexpected stats. got %+v", stats)
+	}
+}
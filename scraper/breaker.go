@@ -0,0 +1,254 @@
+package scraper
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/clock"
+)
+
+// BreakerState is the state of the circuit breaker of a host.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // targets of the host are fetched
+	BreakerOpen                         // targets of the host are parked until the cool-down passes
+	BreakerHalfOpen                     // a single probe of the host is fetched, deciding whether the breaker closes or opens again
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "CLOSED"
+	case BreakerOpen:
+		return "OPEN"
+	case BreakerHalfOpen:
+		return "HALF-OPEN"
+	}
+	panic("unknown breaker state")
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the states are readable in the stats.
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BreakerConfig configures the circuit breakers of the hosts.
+type BreakerConfig struct {
+	FailureThreshold int           // consecutive failed fetches of the host opening its breaker
+	Cooldown         time.Duration // how long the breaker stays open before a probe is let through
+	ProbeSuccesses   int           // successful probes in a row closing the half-open breaker, 1 if zero
+}
+
+// breaker is the circuit breaker of a single host.
+type breaker struct {
+	state     BreakerState
+	failures  int       // consecutive failures while closed
+	successes int       // successful probes while half-open
+	openedAt  time.Time // time of the last opening
+	probedAt  time.Time // time the running probe was let through, zero if there is none
+}
+
+// breakers are the circuit breakers of the hosts. Breakers are created with the first failure of the host
+// and removed once they close again.
+type breakers struct {
+	cfg BreakerConfig
+
+	mu    sync.Mutex // mutex protecting hosts
+	hosts map[string]*breaker
+}
+
+func newBreakers(cfg BreakerConfig) *breakers {
+	if cfg.ProbeSuccesses <= 0 {
+		cfg.ProbeSuccesses = 1
+	}
+	return &breakers{cfg: cfg, hosts: make(map[string]*breaker)}
+}
+
+// allow reports whether a target of the host may be fetched. Open breakers let a single probe through
+// once the cool-down passes, turning half-open. Probes that didn't report back within the cool-down are replaced.
+// Returns the state transition, if any.
+func (b *breakers) allow(host string) (bool, BreakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.hosts[host]
+	if !ok || br.state == BreakerClosed {
+		return true, BreakerClosed, false
+	}
+	now := clock.Now()
+	if b.blocks(br, now) {
+		return false, br.state, false
+	}
+	br.probedAt = now
+	if br.state == BreakerOpen {
+		br.state, br.successes = BreakerHalfOpen, 0
+		return true, br.state, true
+	}
+	return true, br.state, false
+}
+
+// blocked reports whether the breaker of the host blocks its fetches right now, without letting a probe through.
+func (b *breakers) blocked(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.hosts[host]
+	return ok && b.blocks(br, clock.Now())
+}
+
+// blocks reports whether the breaker blocks the fetches at the time: it's open and cooling down,
+// or half-open with its probe running.
+func (b *breakers) blocks(br *breaker, now time.Time) bool {
+	switch br.state {
+	case BreakerOpen:
+		return now.Sub(br.openedAt) < b.cfg.Cooldown
+	case BreakerHalfOpen:
+		return !br.probedAt.IsZero() && now.Sub(br.probedAt) < b.cfg.Cooldown
+	}
+	return false
+}
+
+// record records the outcome of the fetch of the host. Returns the state transition, if any.
+func (b *breakers) record(host string, failed bool) (BreakerState, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.hosts[host]
+	if !ok {
+		if !failed {
+			return BreakerClosed, false
+		}
+		br = &breaker{}
+		b.hosts[host] = br
+	}
+	switch br.state {
+	case BreakerClosed:
+		if !failed {
+			delete(b.hosts, host)
+			return BreakerClosed, false
+		}
+		br.failures++
+		if br.failures < b.cfg.FailureThreshold {
+			return br.state, false
+		}
+		br.state, br.openedAt = BreakerOpen, clock.Now()
+		return br.state, true
+	case BreakerHalfOpen:
+		br.probedAt = time.Time{}
+		if failed {
+			br.state, br.openedAt = BreakerOpen, clock.Now()
+			return br.state, true
+		}
+		br.successes++
+		if br.successes < b.cfg.ProbeSuccesses {
+			return br.state, false
+		}
+		delete(b.hosts, host)
+		return BreakerClosed, true
+	}
+	// fetches started before the breaker opened
+	return br.state, false
+}
+
+// states returns the states of the breakers that aren't closed.
+func (b *breakers) states() map[string]BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	states := make(map[string]BreakerState)
+	for host, br := range b.hosts {
+		if br.state != BreakerClosed {
+			states[host] = br.state
+		}
+	}
+	return states
+}
+
+// WithCircuitBreaker enables the circuit breakers of the hosts. Hosts failing cfg.FailureThreshold fetches in a row,
+// by errors, timeouts or 5xx and 429 responses, have their targets parked instead of fetched until the cool-down passes.
+// Breakers are disabled by default.
+func (s *Scrapper) WithCircuitBreaker(cfg BreakerConfig) *Scrapper {
+	s.breakers = newBreakers(cfg)
+	return s
+}
+
+// allowHost reports whether the target may be fetched according to the breaker of its host.
+func (s *Scrapper) allowHost(target scrapeTarget, host string) bool {
+	if s.breakers == nil {
+		return true
+	}
+	allowed, state, changed := s.breakers.allow(host)
+	if changed {
+		s.breakerChanged(target, host, state)
+	}
+	return allowed
+}
+
+// recordHost passes the outcome of the fetch to the breaker of the host of the target, err being the failure classified by fetchFailure.
+func (s *Scrapper) recordHost(target scrapeTarget, host string, err error) {
+	if s.breakers == nil {
+		return
+	}
+	if state, changed := s.breakers.record(host, err != nil); changed {
+		s.breakerChanged(target, host, state)
+	}
+}
+
+// parking holds the targets of the hosts whose breakers block their fetches, until the breakers let them through.
+// Accessed only by the eventLoop.
+type parking struct {
+	hosts map[string][]scrapeTarget
+	size  int
+}
+
+func newParking() *parking {
+	return &parking{hosts: make(map[string][]scrapeTarget)}
+}
+
+// park holds the target of the host.
+func (p *parking) park(host string, target scrapeTarget) {
+	p.hosts[host] = append(p.hosts[host], target)
+	p.size++
+}
+
+// unpark returns the held targets of the hosts that aren't blocked anymore.
+func (p *parking) unpark(blocked func(host string) bool) []scrapeTarget {
+	var targets []scrapeTarget
+	for host, held := range p.hosts {
+		if blocked(host) {
+			continue
+		}
+		targets = append(targets, held...)
+		p.size -= len(held)
+		delete(p.hosts, host)
+	}
+	return targets
+}
+
+// targets returns the held targets.
+func (p *parking) targets() []scrapeTarget {
+	targets := make([]scrapeTarget, 0, p.size)
+	for _, held := range p.hosts {
+		targets = append(targets, held...)
+	}
+	return targets
+}
+
+// len returns the amount of held targets.
+func (p *parking) len() int { return p.size }
+
+// breakerStates returns the states of the breakers that aren't closed, or nil if breakers aren't enabled.
+func (s *Scrapper) breakerStates() map[string]BreakerState {
+	if s.breakers == nil {
+		return nil
+	}
+	return s.breakers.states()
+}
+
+func (s *Scrapper) breakerChanged(target scrapeTarget, host string, state BreakerState) {
+	if state == BreakerOpen {
+		s.logger.Warn("circuit breaker opened", "host:", host)
+	} else {
+		s.logger.Info("circuit breaker changed", "host:", host, "state:", state.String())
+	}
+	event := newEvent(target)
+	event.Host, event.Breaker = host, state
+	s.events.emit(eventBreakerChanged, event)
+}
@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/clock"
+)
+
+func TestBreakers(t *testing.T) {
+	current := clock.CurrentClock()
+	defer clock.SetClock(current)
+	testingClock := clock.NewRewindableClock()
+	clock.SetClock(testingClock)
+
+	b := newBreakers(BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute, ProbeSuccesses: 2})
+	expect := func(state BreakerState, changed bool, wantState BreakerState, wantChanged bool) {
+		t.Helper()
+		if state != wantState || changed != wantChanged {
+			t.Fatalf("unexpected transition to %v (changed %v), want %v (changed %v)", state, changed, wantState, wantChanged)
+		}
+	}
+
+	// successes reset the consecutive failures
+	state, changed := b.record("host", true)
+	expect(state, changed, BreakerClosed, false)
+	state, changed = b.record("host", false)
+	expect(state, changed, BreakerClosed, false)
+	state, changed = b.record("host", true)
+	expect(state, changed, BreakerClosed, false)
+	state, changed = b.record("host", true)
+	expect(state, changed, BreakerOpen, true)
+	if allowed, _, _ := b.allow("host"); allowed {
+		t.Fatal("open breaker allowed fetch")
+	}
+	if allowed, _, _ := b.allow("other"); !allowed {
+		t.Fatal("breaker of other host affected")
+	}
+
+	// single probe after the cool-down, its failure opens the breaker again
+	testingClock.Rewind(testingClock.Add(time.Minute))
+	allowed, state, changed := b.allow("host")
+	if !allowed {
+		t.Fatal("probe not allowed")
+	}
+	expect(state, changed, BreakerHalfOpen, true)
+	if allowed, _, _ := b.allow("host"); allowed {
+		t.Fatal("second probe allowed")
+	}
+	state, changed = b.record("host", true)
+	expect(state, changed, BreakerOpen, true)
+
+	// successful probes close it
+	testingClock.Rewind(testingClock.Add(time.Minute))
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := b.allow("host"); !allowed {
+			t.Fatal("probe not allowed")
+		}
+		state, changed = b.record("host", false)
+	}
+	expect(state, changed, BreakerClosed, true)
+	if states := b.states(); len(states) != 0 {
+		t.Fatalf("unexpected states %v", states)
+	}
+}
+
+// breakerObserver collects the state changes of the breakers.
+type breakerObserver struct {
+	NopObserver
+	mu      sync.Mutex
+	states  []BreakerState
+	retries int
+}
+
+func (o *breakerObserver) OnBreakerChanged(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.states = append(o.states, e.Breaker)
+}
+
+func (o *breakerObserver) OnRetryScheduled(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retries++
+}
+
+func (o *breakerObserver) retried() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.retries
+}
+
+func (o *breakerObserver) get() []BreakerState {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]BreakerState(nil), o.states...)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	observer := &breakerObserver{}
+	scrapper := NewScrapper(nil).WithThreads(1).WithObserver(observer).WithCircuitBreaker(BreakerConfig{FailureThreshold: 2, Cooldown: time.Hour})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, path := range []string{"/a", "/b"} {
+		handle, err := scrapper.ScrapeContext(ctx, server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle.Wait(ctx)
+	}
+	if state := scrapper.Stats().Breakers[HostOf(server.URL)]; state != BreakerOpen {
+		t.Fatalf("unexpected breaker state %v", state)
+	}
+
+	// targets of the open host are parked, not fetched
+	handle, err := scrapper.ScrapeContext(ctx, server.URL+"/c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for handle.Status() != JobRetrying || scrapper.Stats().Retrying != 1 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("target not parked")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	mu.Lock()
+	fetched := requests
+	mu.Unlock()
+	if fetched != 2 {
+		t.Fatalf("unexpected requests %d", fetched)
+	}
+
+	for len(observer.get()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("breaker event not delivered")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if states := observer.get(); states[0] != BreakerOpen {
+		t.Fatalf("unexpected breaker events %v", states)
+	}
+
+	// the parked target stays held past the retry tick, scheduled for retry once
+	time.Sleep(3500 * time.Millisecond)
+	if handle.Status() != JobRetrying || scrapper.Stats().Retrying != 1 {
+		t.Fatalf("target not held. status %v, retrying %v", handle.Status(), scrapper.Stats().Retrying)
+	}
+	if retries := observer.retried(); retries != 1 {
+		t.Fatalf("unexpected retry events %v", retries)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	scrapper := NewScrapper(nil).WithThreads(1).WithFetchTimeout(100 * time.Millisecond)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	handle, err := scrapper.ScrapeContext(ctx, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle.Wait(ctx)
+	if handle.Status() != JobFailed {
+		t.Fatalf("unexpected status %v, err %v", handle.Status(), handle.Err())
+	}
+}
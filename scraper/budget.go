@@ -0,0 +1,164 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is the error of targets cancelled because the crawl or host budget has been exceeded.
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget limits the amount of work done by a crawl or for a single host. Zero value of a limit means unlimited.
+type Budget struct {
+	MaxPages             int           // pages fetched
+	MaxBytes             int64         // bytes downloaded
+	MaxDuration          time.Duration // wall-clock time since the first fetch
+	MaxConsecutiveErrors int           // failed fetches in a row, including 5xx and 429 responses
+}
+
+// BudgetUsage represents the consumption of a budget.
+type BudgetUsage struct {
+	Pages             int
+	Bytes             int64
+	Elapsed           time.Duration
+	ConsecutiveErrors int
+	Exceeded          string // reason of exceeding the budget, empty if not exceeded
+}
+
+// BudgetReport represents the consumption of the crawl budget and budgets of every host.
+type BudgetReport struct {
+	Crawl BudgetUsage
+	Hosts map[string]BudgetUsage
+}
+
+// budgetUsage tracks the consumption of a single budget.
+type budgetUsage struct {
+	started           time.Time
+	admitted          int // fetches admitted, including the ones that haven't finished yet
+	pages             int
+	bytes             int64
+	consecutiveErrors int
+	exceeded          string
+}
+
+// check returns the reason of exceeding the budget, or empty string if it's not exceeded.
+func (u *budgetUsage) check(b Budget, now time.Time) string {
+	if u.exceeded != "" {
+		return u.exceeded
+	}
+	switch {
+	case b.MaxPages > 0 && u.admitted >= b.MaxPages:
+		u.exceeded = fmt.Sprintf("max pages %d", b.MaxPages)
+	case b.MaxBytes > 0 && u.bytes >= b.MaxBytes:
+		u.exceeded = fmt.Sprintf("max bytes %d", b.MaxBytes)
+	case b.MaxDuration > 0 && !u.started.IsZero() && now.Sub(u.started) >= b.MaxDuration:
+		u.exceeded = fmt.Sprintf("max duration %s", b.MaxDuration)
+	case b.MaxConsecutiveErrors > 0 && u.consecutiveErrors >= b.MaxConsecutiveErrors:
+		u.exceeded = fmt.Sprintf("max consecutive errors %d", b.MaxConsecutiveErrors)
+	}
+	return u.exceeded
+}
+
+func (u *budgetUsage) report(now time.Time) BudgetUsage {
+	var elapsed time.Duration
+	if !u.started.IsZero() {
+		elapsed = now.Sub(u.started)
+	}
+	return BudgetUsage{
+		Pages:             u.pages,
+		Bytes:             u.bytes,
+		Elapsed:           elapsed,
+		ConsecutiveErrors: u.consecutiveErrors,
+		Exceeded:          u.exceeded,
+	}
+}
+
+// budgetTracker tracks the consumption of the crawl budget and the budgets of every host.
+type budgetTracker struct {
+	mu    sync.Mutex
+	crawl Budget
+	host  Budget
+
+	crawlUsage budgetUsage
+	hostsUsage map[string]*budgetUsage
+}
+
+func newBudgetTracker(crawl, host Budget) *budgetTracker {
+	return &budgetTracker{
+		crawl:      crawl,
+		host:       host,
+		hostsUsage: make(map[string]*budgetUsage),
+	}
+}
+
+// check returns ErrBudgetExceeded if either of the crawl or the host budget is exceeded.
+func (t *budgetTracker) check(host string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if reason := t.crawlUsage.check(t.crawl, now); reason != "" {
+		return fmt.Errorf("%w: crawl %s", ErrBudgetExceeded, reason)
+	}
+	if reason := t.hostUsage(host).check(t.host, now); reason != "" {
+		return fmt.Errorf("%w: host %s %s", ErrBudgetExceeded, host, reason)
+	}
+	return nil
+}
+
+// admit accounts a new fetch of the host, which has passed the check.
+func (t *budgetTracker) admit(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for _, u := range []*budgetUsage{&t.crawlUsage, t.hostUsage(host)} {
+		if u.started.IsZero() {
+			u.started = now
+		}
+		u.admitted++
+	}
+}
+
+// record records the outcome of an admitted fetch, err being the failure classified by fetchFailure.
+// Responses count towards the pages and bytes even if their status is a failure. Cancelled fetches shouldn't be recorded.
+func (t *budgetTracker) record(host string, page *Page, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, u := range []*budgetUsage{&t.crawlUsage, t.hostUsage(host)} {
+		if page != nil {
+			u.pages++
+			u.bytes += int64(len(page.Body))
+		}
+		if err != nil {
+			u.consecutiveErrors++
+			continue
+		}
+		u.consecutiveErrors = 0
+	}
+}
+
+// report returns the current consumption of the budgets.
+func (t *budgetTracker) report() BudgetReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	report := BudgetReport{
+		Crawl: t.crawlUsage.report(now),
+		Hosts: make(map[string]BudgetUsage, len(t.hostsUsage)),
+	}
+	for host, usage := range t.hostsUsage {
+		report.Hosts[host] = usage.report(now)
+	}
+	return report
+}
+
+// hostUsage returns the usage of the host. Must be called with mu held.
+func (t *budgetTracker) hostUsage(host string) *budgetUsage {
+	usage, ok := t.hostsUsage[host]
+	if !ok {
+		usage = &budgetUsage{}
+		t.hostsUsage[host] = usage
+	}
+	return usage
+}
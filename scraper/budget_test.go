@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBudgetTracker checks that the limits of crawl and host budgets are enforced and reported.
+func TestBudgetTracker(t *testing.T) {
+	tracker := newBudgetTracker(Budget{MaxPages: 4}, Budget{MaxBytes: 10, MaxConsecutiveErrors: 2})
+
+	// bytes of host a
+	if err := tracker.check("a"); err != nil {
+		t.Fatal(err)
+	}
+	tracker.admit("a")
+	tracker.record("a", &Page{Body: "0123456789"}, nil)
+	if err := tracker.check("a"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrBudgetExceeded)
+	}
+
+	// errors of host b
+	tracker.admit("b")
+	tracker.record("b", nil, errors.New("failed"))
+	if err := tracker.check("b"); err != nil {
+		t.Fatal(err)
+	}
+	// responses with a retryable status are errors as well
+	tracker.admit("b")
+	unavailable := &Page{StatusCode: http.StatusServiceUnavailable}
+	tracker.record("b", unavailable, fetchFailure(unavailable, nil))
+	if err := tracker.check("b"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrBudgetExceeded)
+	}
+
+	// pages of the crawl
+	tracker.admit("c")
+	if err := tracker.check("c"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrBudgetExceeded)
+	}
+
+	report := tracker.report()
+	if report.Crawl.Pages != 2 || report.Crawl.Bytes != 10 || report.Crawl.Exceeded == "" {
+		t.Fatalf("unexpected crawl usage %+v", report.Crawl)
+	}
+	if report.Hosts["b"].ConsecutiveErrors != 2 || report.Hosts["b"].Exceeded == "" {
+		t.Fatalf("unexpected host usage %+v", report.Hosts["b"])
+	}
+}
+
+// TestScrapeBudget checks that targets beyond the crawl budget are cancelled with ErrBudgetExceeded.
+func TestScrapeBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(2).WithBudget(Budget{MaxPages: 2})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	handles := make([]*JobHandle, 0, 5)
+	for i := 0; i < 5; i++ {
+		handle, err := scrapper.Scrape(fmt.Sprintf("%v/%v", server.URL, i), &testingCallbackAnalyzer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, handle)
+	}
+
+	done, exceeded := 0, 0
+	for _, handle := range handles {
+		<-handle.Done()
+		switch {
+		case handle.Status() == JobDone:
+			done++
+		case errors.Is(handle.Err(), ErrBudgetExceeded):
+			exceeded++
+		default:
+			t.Fatalf("unexpected job outcome. status %v, err %v", handle.Status(), handle.Err())
+		}
+	}
+	if done != 2 || exceeded != 3 {
+		t.Fatalf("unexpected outcomes. got %v done and %v exceeded, want 2 and 3", done, exceeded)
+	}
+	if report := scrapper.BudgetReport(); report.Crawl.Pages != 2 {
+		t.Fatalf("unexpected pages in report. got %v, want %v", report.Crawl.Pages, 2)
+	}
+}
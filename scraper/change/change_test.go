@@ -0,0 +1,57 @@
+package change
+
+import (
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		old, new []string
+		want     string
+	}{
+		{old: []string{"a", "b", "c"}, new: []string{"a", "b", "c"}, want: ""},
+		{old: []string{"a", "b", "c"}, new: []string{"a", "x", "c"}, want: "- b\n+ x"},
+		{old: []string{"a", "b"}, new: []string{"a", "b", "c"}, want: "+ c"},
+		{old: []string{"a", "b", "c", "d"}, new: []string{"b", "d", "e"}, want: "- a\n- c\n+ e"},
+		{old: nil, new: []string{"a"}, want: "+ a"},
+	}
+	for _, test := range tests {
+		if got := DiffLines(test.old, test.new).String(); got != test.want {
+			t.Fatalf("unexpected diff of %v and %v. got %q, want %q", test.old, test.new, got, test.want)
+		}
+	}
+}
+
+func TestDetector(t *testing.T) {
+	detector, err := NewDetector("#price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := []struct {
+		page    string
+		changed bool
+	}{
+		{page: `<div id="price">10 €</div><p>news</p>`, changed: false}, // first version
+		{page: `<div id="price">  10 €  </div><p>other news</p>`, changed: false},
+		{page: `<div id="price">12 €</div><script>x()</script>`, changed: true},
+	}
+	var change *Change
+	for i, p := range pages {
+		if change, err = detector.Observe("url", p.page); err != nil {
+			t.Fatal(err)
+		}
+		if (change != nil) != p.changed {
+			t.Fatalf("unexpected change of page %v. got %+v", i, change)
+		}
+	}
+	if change.Diff.String() != "- 10 €\n+ 12 €" || change.OldHash == change.NewHash {
+		t.Fatalf("unexpected change %+v", change)
+	}
+	if hash, ok := detector.Hash("url"); !ok || hash != change.NewHash {
+		t.Fatalf("unexpected hash %v", hash)
+	}
+
+	if _, err := NewDetector("a[href"); err == nil {
+		t.Fatal("created detector with invalid selector")
+	}
+}
@@ -0,0 +1,84 @@
+package change
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+// Change describes the change of the content of the url between two scrapes.
+type Change struct {
+	URL        string
+	OldHash    string
+	NewHash    string
+	Diff       Diff
+	DetectedAt time.Time
+}
+
+// version is the last known content of the url.
+type version struct {
+	hash string
+	text []string
+}
+
+// Detector detects changes of the content of the urls between their scrapes.
+// It keeps the hash and the text of the last version of every url, normalized so that
+// changes of the markup, scripts, styles and whitespace don't count as content changes.
+type Detector struct {
+	selector *html.Selector // region of the page that is compared, nil compares the whole page
+
+	mu       sync.Mutex // mutex protecting versions
+	versions map[string]version
+}
+
+// NewDetector creates a detector comparing the text of the elements matching the CSS selector.
+// Empty selector compares the text of the whole page.
+func NewDetector(selector string) (*Detector, error) {
+	d := &Detector{versions: make(map[string]version)}
+	if selector != "" {
+		var err error
+		if d.selector, err = html.ParseSelector(selector); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Observe records the scraped page of the url and returns its change since the previous version.
+// Returns nil if the url is seen for the first time or its content didn't change.
+func (d *Detector) Observe(url string, page string) (*Change, error) {
+	text, err := html.ExtractText(page, d.selector)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(strings.Join(text, "\n")))
+	current := version{hash: hex.EncodeToString(sum[:]), text: text}
+
+	d.mu.Lock()
+	previous, ok := d.versions[url]
+	d.versions[url] = current
+	d.mu.Unlock()
+
+	if !ok || previous.hash == current.hash {
+		return nil, nil
+	}
+	return &Change{
+		URL:        url,
+		OldHash:    previous.hash,
+		NewHash:    current.hash,
+		Diff:       DiffLines(previous.text, current.text),
+		DetectedAt: time.Now(),
+	}, nil
+}
+
+// Hash returns the hash of the last known content of the url, or false if the url wasn't observed yet.
+func (d *Detector) Hash(url string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.versions[url]
+	return v.hash, ok
+}
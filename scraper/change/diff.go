@@ -0,0 +1,129 @@
+package change
+
+import "strings"
+
+// Op is the operation of a diff line.
+type Op int
+
+const (
+	Equal  Op = iota // line present in both versions
+	Insert           // line present only in the new version
+	Delete           // line present only in the old version
+)
+
+// DiffLine is a single line of a diff.
+type DiffLine struct {
+	Op   Op
+	Text string
+}
+
+// Diff is a line based difference between two versions of a text.
+type Diff []DiffLine
+
+// String formats the diff like unified diff lines without the context headers, eg. "- 10 €\n+ 12 €".
+// Equal lines are omitted.
+func (d Diff) String() string {
+	var b strings.Builder
+	for _, line := range d {
+		switch line.Op {
+		case Insert:
+			b.WriteString("+ ")
+		case Delete:
+			b.WriteString("- ")
+		default:
+			continue
+		}
+		b.WriteString(line.Text)
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Changed returns the lines that were inserted or deleted.
+func (d Diff) Changed() Diff {
+	changed := make(Diff, 0, len(d))
+	for _, line := range d {
+		if line.Op != Equal {
+			changed = append(changed, line)
+		}
+	}
+	return changed
+}
+
+// maxLCS bounds the size of the table of the longest common subsequence.
+// Bigger changes are reported as deletion of all old lines and insertion of all new ones.
+const maxLCS = 1 << 22
+
+// DiffLines computes the diff of the old and new lines, based on their longest common subsequence.
+func DiffLines(old, new []string) Diff {
+	// common prefix and suffix don't need the table
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	diff := make(Diff, 0, max(len(old), len(new)))
+	for _, line := range old[:prefix] {
+		diff = append(diff, DiffLine{Op: Equal, Text: line})
+	}
+	diff = append(diff, diffMiddle(old[prefix:len(old)-suffix], new[prefix:len(new)-suffix])...)
+	for _, line := range old[len(old)-suffix:] {
+		diff = append(diff, DiffLine{Op: Equal, Text: line})
+	}
+	return diff
+}
+
+// diffMiddle computes the diff of the lines without common prefix and suffix.
+func diffMiddle(old, new []string) Diff {
+	diff := make(Diff, 0, max(len(old), len(new)))
+	if (len(old)+1)*(len(new)+1) > maxLCS {
+		for _, line := range old {
+			diff = append(diff, DiffLine{Op: Delete, Text: line})
+		}
+		for _, line := range new {
+			diff = append(diff, DiffLine{Op: Insert, Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			diff = append(diff, DiffLine{Op: Equal, Text: old[i]})
+			i, j = i+1, j+1
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: Delete, Text: old[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: Insert, Text: new[j]})
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		diff = append(diff, DiffLine{Op: Delete, Text: old[i]})
+	}
+	for ; j < len(new); j++ {
+		diff = append(diff, DiffLine{Op: Insert, Text: new[j]})
+	}
+	return diff
+}
@@ -0,0 +1,563 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/log"
+	"github.com/Exca-DK/webscraper/scraper"
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+	"github.com/Exca-DK/webscraper/scraper/control"
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+var _ Target = (*scraper.Scrapper)(nil)
+
+var (
+	// ErrNotCoordinator is returned when a node that isn't the coordinator is asked to change the membership.
+	ErrNotCoordinator = errors.New("node is not the coordinator")
+	// ErrNotJoined is returned when a node that didn't join any cluster is asked to leave.
+	ErrNotJoined = errors.New("node didn't join a cluster")
+)
+
+// maxHops bounds how many times the urls are forwarded between the nodes.
+// Nodes can disagree about the owner while the membership changes, after maxHops the receiving node keeps the urls.
+const maxHops = 3
+
+// Target is the scrapper of the urls owned by the node.
+type Target interface {
+	ScrapeMultiContext(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*scraper.JobHandle, error)
+}
+
+// Member is a node of the cluster.
+type Member struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"` // base url of the node api, eg. http://10.0.0.1:8080
+}
+
+// Membership is the versioned list of the members of the cluster, distributed by the coordinator.
+type Membership struct {
+	Version uint64   `json:"version"`
+	Members []Member `json:"members"`
+}
+
+// forwardRequest is the body of a request forwarding urls to their owner.
+type forwardRequest struct {
+	URLs []string `json:"urls"`
+	Hops int      `json:"hops"`
+}
+
+// leaveRequest is the body of a request removing a member.
+type leaveRequest struct {
+	ID string `json:"id"`
+}
+
+// Node is a member of a distributed crawl. Hosts are partitioned across the nodes by consistent hashing,
+// every node scrapes only the urls of the hosts it owns and forwards the rest to their owners.
+// One of the nodes is the coordinator, which keeps the membership and distributes it to the other nodes
+// whenever a node joins or leaves. Pending urls of the hosts that changed their owner are handed over to the new owner.
+//
+// The nodes communicate over a json api served by Handler:
+//
+//	POST /urls     scrapes or forwards the urls, eg. {"urls": ["https://go.dev"], "hops": 1}
+//	GET  /members  returns the membership known to the node
+//	PUT  /members  replaces the membership, sent by the coordinator
+//	POST /join     adds a member, coordinator only, eg. {"id": "node-2", "addr": "http://10.0.0.2:8080"}
+//	POST /leave    removes a member, coordinator only, eg. {"id": "node-2"}
+type Node struct {
+	self   Member
+	target Target
+	logger log.Logger
+	client *http.Client
+	mux    *http.ServeMux
+
+	factory     func(url string) analytics.Analyzer // analyzers of the scraped urls, nil if not needed
+	followLinks bool                                // submits the links found on the scraped pages
+
+	ctx       context.Context // scrapes of the node, cancelled once the node is closed
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup // running background submissions
+	handovers sync.WaitGroup // running hand-overs of the pending urls, finished before the node is closed
+
+	mu          sync.Mutex // mutex protecting fields below
+	closed      bool
+	coordinator string // address of the coordinator, empty if the node is the coordinator
+	joined      bool   // node is a member of a cluster with other coordinator
+	membership  Membership
+	ring        *Ring
+	pending     map[string]*scraper.JobHandle // local jobs by url, handed over when their host changes the owner
+	pruneAt     int                           // size of pending at which finished jobs are removed
+}
+
+// NewNode creates a node scraping its urls with the target. The node starts as the coordinator of a cluster with itself as the only member.
+func NewNode(self Member, target Target, logger log.Logger) *Node {
+	if logger == nil {
+		logger = log.NewLogger(log.Info, os.Stdout)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Node{
+		self:    self,
+		target:  target,
+		logger:  logger,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		ctx:     ctx,
+		cancel:  cancel,
+		ring:    NewRing(DefaultReplicas),
+		pending: make(map[string]*scraper.JobHandle),
+		pruneAt: 64,
+	}
+	n.setMembership(Membership{Version: 1, Members: []Member{self}})
+	n.mux = http.NewServeMux()
+	n.mux.HandleFunc("/urls", n.handleURLs)
+	n.mux.HandleFunc("/members", n.handleMembers)
+	n.mux.HandleFunc("/join", n.handleJoin)
+	n.mux.HandleFunc("/leave", n.handleLeave)
+	return n
+}
+
+// WithAnalyzers configures the factory of the analyzers of the urls scraped by the node, including the forwarded ones.
+func (n *Node) WithAnalyzers(factory func(url string) analytics.Analyzer) *Node {
+	n.factory = factory
+	return n
+}
+
+// WithFollowLinks makes the node submit the links found on the scraped pages, so that the cluster crawls them.
+func (n *Node) WithFollowLinks(follow bool) *Node {
+	n.followLinks = follow
+	return n
+}
+
+// WithClient configures the http client used for talking to the other nodes.
+func (n *Node) WithClient(client *http.Client) *Node {
+	n.client = client
+	return n
+}
+
+// Handler returns http.Handler serving the api of the node.
+func (n *Node) Handler() http.Handler {
+	return n.mux
+}
+
+// ID returns the id of the node.
+func (n *Node) ID() string {
+	return n.self.ID
+}
+
+// Membership returns the membership known to the node.
+func (n *Node) Membership() Membership {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.membership
+}
+
+// Owner returns the member owning the host of the url.
+func (n *Node) Owner(rawURL string) Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ownerLocked(scraper.HostOf(rawURL))
+}
+
+// ownerLocked returns the member owning the host.
+func (n *Node) ownerLocked(host string) Member {
+	id, ok := n.ring.Owner(host)
+	if !ok {
+		return n.self
+	}
+	for _, member := range n.membership.Members {
+		if member.ID == id {
+			return member
+		}
+	}
+	return n.self
+}
+
+// Join joins the cluster of the coordinator. The node starts receiving the urls of its hosts
+// once the coordinator distributes the new membership.
+func (n *Node) Join(ctx context.Context, coordinator string) error {
+	var membership Membership
+	if err := n.call(ctx, http.MethodPost, coordinator+"/join", n.self, &membership); err != nil {
+		return fmt.Errorf("joining %v: %w", coordinator, err)
+	}
+	n.mu.Lock()
+	n.coordinator, n.joined = coordinator, true
+	n.mu.Unlock()
+	n.apply(membership)
+	return nil
+}
+
+// Leave leaves the cluster. Pending urls of the node are handed over to the remaining members in the background, Close waits for them.
+func (n *Node) Leave(ctx context.Context) error {
+	n.mu.Lock()
+	coordinator, joined := n.coordinator, n.joined
+	n.mu.Unlock()
+	if !joined {
+		return ErrNotJoined
+	}
+	var membership Membership
+	if err := n.call(ctx, http.MethodPost, coordinator+"/leave", leaveRequest{ID: n.self.ID}, &membership); err != nil {
+		return fmt.Errorf("leaving %v: %w", coordinator, err)
+	}
+	n.mu.Lock()
+	n.joined = false
+	n.mu.Unlock()
+	n.apply(membership)
+	return nil
+}
+
+// Close waits for the running hand-overs, so that the urls handed over by Leave aren't lost,
+// then cancels the jobs submitted through the node and waits for the running background submissions.
+func (n *Node) Close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	n.handovers.Wait()
+	n.cancel()
+	n.wg.Wait()
+}
+
+// submitAsync submits the urls in the background, unless the node is closed. Returns false if the node is closed.
+func (n *Node) submitAsync(urls []string, hops int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return false
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.submit(n.ctx, urls, hops); err != nil {
+			n.logger.Warn("failed submitting urls", "node:", n.self.ID, "urls:", len(urls), "err:", err.Error())
+		}
+	}()
+	return true
+}
+
+// Submit scrapes the urls of the hosts owned by the node and forwards the rest to their owners.
+// Urls that can't be forwarded are scraped by the node itself. Local jobs are cancelled when ctx is done, see scraper.Scrapper.ScrapeMultiContext.
+func (n *Node) Submit(ctx context.Context, urls []string) error {
+	return n.submit(ctx, urls, 0)
+}
+
+func (n *Node) submit(ctx context.Context, urls []string, hops int) error {
+	local, foreign := n.partition(urls, hops)
+	for owner, urls := range foreign {
+		if err := n.call(ctx, http.MethodPost, owner.Addr+"/urls", forwardRequest{URLs: urls, Hops: hops + 1}, nil); err != nil {
+			n.logger.Warn("failed forwarding urls, scraping them locally", "node:", owner.ID, "urls:", len(urls), "err:", err.Error())
+			local = append(local, urls...)
+			continue
+		}
+		n.logger.Debug("forwarded urls", "node:", owner.ID, "urls:", len(urls))
+	}
+	return n.scrape(ctx, local)
+}
+
+// partition splits the urls into the ones owned by the node and the ones of other members.
+// Urls forwarded maxHops times are kept by the node.
+func (n *Node) partition(urls []string, hops int) ([]string, map[Member][]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var local []string
+	foreign := make(map[Member][]string)
+	for _, url := range urls {
+		owner := n.ownerLocked(scraper.HostOf(url))
+		if owner.ID == n.self.ID || hops >= maxHops {
+			local = append(local, url)
+			continue
+		}
+		foreign[owner] = append(foreign[owner], url)
+	}
+	return local, foreign
+}
+
+// scrape queues the urls in the target and tracks them until they start, so that they can be handed over.
+func (n *Node) scrape(ctx context.Context, urls []string) error {
+	for _, url := range urls {
+		var analyzer analytics.Analyzer
+		if n.factory != nil {
+			analyzer = n.factory(url)
+		}
+		if n.followLinks {
+			analyzer = &linkAnalyzer{node: n, next: analyzer}
+		}
+		handles, err := n.target.ScrapeMultiContext(ctx, []string{url}, analyzer)
+		if err != nil {
+			return err
+		}
+		n.track(handles[0])
+	}
+	return nil
+}
+
+// track remembers the pending job. Finished jobs are removed once the amount of tracked jobs doubles.
+func (n *Node) track(handle *scraper.JobHandle) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	// duplicates are dropped by the target, so the job of the first submission is kept
+	if previous, ok := n.pending[handle.URL()]; ok && !previous.Status().Finished() {
+		return
+	}
+	n.pending[handle.URL()] = handle
+	if len(n.pending) < n.pruneAt {
+		return
+	}
+	for url, h := range n.pending {
+		if h.Status().Finished() {
+			delete(n.pending, url)
+		}
+	}
+	n.pruneAt = max(64, 2*len(n.pending))
+}
+
+// apply replaces the membership with a newer one and hands the pending urls of the hosts owned by other members over to them.
+// Handed over jobs are cancelled locally, the new owner scrapes them with its own analyzers.
+func (n *Node) apply(membership Membership) {
+	if !n.setMembership(membership) {
+		return
+	}
+	n.logger.Info("cluster membership changed", "node:", n.self.ID, "version:", membership.Version, "members:", len(membership.Members))
+
+	n.mu.Lock()
+	var moved []string
+	for url, handle := range n.pending {
+		status := handle.Status()
+		if status != scraper.JobQueued && status != scraper.JobRetrying {
+			if status.Finished() {
+				delete(n.pending, url)
+			}
+			continue
+		}
+		if owner := n.ownerLocked(scraper.HostOf(url)); owner.ID != n.self.ID {
+			handle.Cancel()
+			delete(n.pending, url)
+			moved = append(moved, url)
+		}
+	}
+	n.mu.Unlock()
+	if len(moved) == 0 {
+		return
+	}
+	n.logger.Info("handing over urls", "node:", n.self.ID, "urls:", len(moved))
+	n.handOver(moved)
+}
+
+// handOver submits the urls moved to other members in the background, unless the node is closed.
+// Unlike the other background submissions, hand-overs are waited for by Close before the submissions are cancelled.
+func (n *Node) handOver(urls []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		n.logger.Warn("node closed, urls not handed over", "node:", n.self.ID, "urls:", len(urls))
+		return
+	}
+	n.handovers.Add(1)
+	go func() {
+		defer n.handovers.Done()
+		if err := n.submit(n.ctx, urls, 0); err != nil {
+			n.logger.Warn("failed handing over urls", "node:", n.self.ID, "urls:", len(urls), "err:", err.Error())
+		}
+	}()
+}
+
+// setMembership replaces the membership and rebuilds the ring. Returns false if the membership isn't newer than the current one.
+func (n *Node) setMembership(membership Membership) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if membership.Version <= n.membership.Version {
+		return false
+	}
+	n.membership = membership
+	n.ring = NewRing(DefaultReplicas)
+	for _, member := range membership.Members {
+		n.ring.Add(member.ID)
+	}
+	return true
+}
+
+// changeMembership adds or removes the member as the coordinator and distributes the new membership to the members.
+func (n *Node) changeMembership(ctx context.Context, add *Member, remove string) (Membership, error) {
+	n.mu.Lock()
+	if n.joined {
+		n.mu.Unlock()
+		return Membership{}, ErrNotCoordinator
+	}
+	next := Membership{Version: n.membership.Version + 1}
+	previous := n.membership.Members
+	for _, member := range previous {
+		if member.ID != remove && (add == nil || member.ID != add.ID) {
+			next.Members = append(next.Members, member)
+		}
+	}
+	if add != nil {
+		next.Members = append(next.Members, *add)
+	}
+	n.mu.Unlock()
+
+	// the leaving member is notified as well, so that it hands over its urls
+	notified := append(append([]Member{}, next.Members...), previous...)
+	sent := map[string]struct{}{n.self.ID: {}}
+	for _, member := range notified {
+		if _, ok := sent[member.ID]; ok {
+			continue
+		}
+		sent[member.ID] = struct{}{}
+		if err := n.call(ctx, http.MethodPut, member.Addr+"/members", next, nil); err != nil {
+			n.logger.Warn("failed distributing membership", "node:", member.ID, "err:", err.Error())
+		}
+	}
+	n.apply(next)
+	return next, nil
+}
+
+func (n *Node) handleURLs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req forwardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// urls are accepted without waiting for space in the backlog, so that the sender doesn't time out and scrape them as well
+	if !n.submitAsync(req.URLs, req.Hops) {
+		http.Error(w, "node is closed", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (n *Node) handleMembers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var membership Membership
+		if err := json.NewDecoder(r.Body).Decode(&membership); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n.apply(membership)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	control.WriteJSON(w, n.Membership())
+}
+
+func (n *Node) handleJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var member Member
+	if err := json.NewDecoder(r.Body).Decode(&member); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if member.ID == "" || member.Addr == "" {
+		http.Error(w, "id and addr are required", http.StatusBadRequest)
+		return
+	}
+	n.respondMembership(r.Context(), w, &member, "")
+}
+
+func (n *Node) handleLeave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req leaveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ID == n.self.ID {
+		http.Error(w, "coordinator can't leave", http.StatusBadRequest)
+		return
+	}
+	n.respondMembership(r.Context(), w, nil, req.ID)
+}
+
+// respondMembership changes the membership and responds with the new one.
+func (n *Node) respondMembership(ctx context.Context, w http.ResponseWriter, add *Member, remove string) {
+	membership, err := n.changeMembership(ctx, add, remove)
+	if errors.Is(err, ErrNotCoordinator) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	control.WriteJSON(w, membership)
+}
+
+// call sends the request with json body to the node and decodes the json response into out, unless it's nil.
+func (n *Node) call(ctx context.Context, method, url string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// linkAnalyzer submits the links found on the page to the cluster and passes the page to the next analyzer.
+type linkAnalyzer struct {
+	node *Node
+	next analytics.Analyzer
+}
+
+// Implements Analyzer.Analyze
+func (a *linkAnalyzer) Analyze(page string) {
+	if a.next != nil {
+		a.next.Analyze(page)
+	}
+	a.submit(html.ExtractUrlsFromPage(page))
+}
+
+// Implements scraper.PageAnalyzer.AnalyzePage, following only the links allowed by the directives honored by the scrapper.
+func (a *linkAnalyzer) AnalyzePage(page *scraper.Page) {
+	if next, ok := a.next.(scraper.PageAnalyzer); ok {
+		next.AnalyzePage(page)
+	} else if a.next != nil {
+		a.next.Analyze(page.Body)
+	}
+	links := page.FollowLinks()
+	urls := make([]string, len(links))
+	for i, link := range links {
+		urls[i] = link.URL
+	}
+	a.submit(urls)
+}
+
+// Implements Analyzer.Cancel
+func (a *linkAnalyzer) Cancel(err error) {
+	if a.next != nil {
+		a.next.Cancel(err)
+	}
+}
+
+// submit submits the links asynchronously, so that the worker isn't blocked by the backlog it's supposed to drain.
+func (a *linkAnalyzer) submit(links []string) {
+	if len(links) > 0 {
+		a.node.submitAsync(links, 0)
+	}
+}
@@ -0,0 +1,336 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/log"
+	"github.com/Exca-DK/webscraper/scraper"
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+// recorder records which nodes scraped the urls.
+type recorder struct {
+	mu      sync.Mutex
+	scrapes map[string][]string
+}
+
+func (r *recorder) analyzer(node string) func(url string) analytics.Analyzer {
+	return func(url string) analytics.Analyzer { return &recordingAnalyzer{recorder: r, node: node, url: url} }
+}
+
+// wait waits until the amount of scraped urls reaches n and returns the scrapes.
+func (r *recorder) wait(t *testing.T, n int) map[string][]string {
+	for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		r.mu.Lock()
+		scraped := len(r.scrapes)
+		r.mu.Unlock()
+		if scraped >= n {
+			break
+		}
+	}
+	// duplicates would show up late
+	time.Sleep(100 * time.Millisecond)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.scrapes) != n {
+		t.Fatalf("unexpected amount of scraped urls. got %v, want %v", len(r.scrapes), n)
+	}
+	return r.scrapes
+}
+
+type recordingAnalyzer struct {
+	recorder  *recorder
+	node, url string
+}
+
+func (a *recordingAnalyzer) Analyze(page string) {
+	a.recorder.mu.Lock()
+	defer a.recorder.mu.Unlock()
+	a.recorder.scrapes[a.url] = append(a.recorder.scrapes[a.url], a.node)
+}
+
+func (a *recordingAnalyzer) Cancel(err error) {}
+
+// newTestNode starts a node with its own scrapper on localhost.
+func newTestNode(t *testing.T, id string, threads int, rec *recorder) *Node {
+	logger := log.NewLogger(log.Warn, io.Discard)
+	srv := httptest.NewUnstartedServer(nil)
+	scrapper := scraper.NewScrapper(logger).WithThreads(threads)
+	node := NewNode(Member{ID: id, Addr: "http://" + srv.Listener.Addr().String()}, scrapper, logger).WithAnalyzers(rec.analyzer(id))
+	srv.Config.Handler = node.Handler()
+	srv.Start()
+	scrapper.Start()
+	t.Cleanup(func() {
+		node.Close()
+		scrapper.Stop()
+		srv.Close()
+	})
+	return node
+}
+
+// newSites starts n sites, every one linking to all of the others.
+func newSites(t *testing.T, n int, handler http.HandlerFunc) []string {
+	urls := make([]string, n)
+	servers := make([]*httptest.Server, n)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		urls[i] = "http://" + servers[i].Listener.Addr().String() + "/"
+	}
+	var links strings.Builder
+	for _, url := range urls {
+		fmt.Fprintf(&links, `<a href="%v">site</a>`, url)
+	}
+	for _, srv := range servers {
+		srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if handler != nil {
+				handler(w, r)
+			}
+			w.Write([]byte("<html><body>" + links.String() + "</body></html>"))
+		})
+		srv.Start()
+		t.Cleanup(srv.Close)
+	}
+	return urls
+}
+
+// TestCrawl checks that the links found by the nodes are scraped exactly once, by the owners of their hosts.
+func TestCrawl(t *testing.T) {
+	rec := &recorder{scrapes: make(map[string][]string)}
+	coordinator := newTestNode(t, "node-0", 2, rec).WithFollowLinks(true)
+	nodes := []*Node{coordinator}
+	for i := 1; i < 3; i++ {
+		node := newTestNode(t, fmt.Sprintf("node-%v", i), 2, rec).WithFollowLinks(true)
+		if err := node.Join(context.Background(), coordinator.Membership().Members[0].Addr); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, node)
+	}
+	for _, node := range nodes {
+		if members := node.Membership().Members; len(members) != 3 {
+			t.Fatalf("unexpected members of %v: %v", node.ID(), members)
+		}
+	}
+
+	sites := newSites(t, 8, nil)
+	// discovering the rest of the sites is up to the cluster
+	if err := nodes[1].Submit(context.Background(), sites[:1]); err != nil {
+		t.Fatal(err)
+	}
+	scrapes := rec.wait(t, len(sites))
+	owners := make(map[string]struct{})
+	for url, scrapedBy := range scrapes {
+		owner := coordinator.Owner(url).ID
+		if len(scrapedBy) != 1 || scrapedBy[0] != owner {
+			t.Fatalf("%v scraped by %v, want %v", url, scrapedBy, owner)
+		}
+		owners[owner] = struct{}{}
+	}
+	if len(owners) < 2 {
+		t.Fatalf("hosts not partitioned, owners %v", owners)
+	}
+}
+
+// threads is the amount of workers of the nodes in TestRebalance.
+const threads = 4
+
+// blockingURLs returns an url of the blocking site for every worker of a node.
+func blockingURLs(site string) []string {
+	urls := make([]string, threads)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%v?worker=%v", site, i)
+	}
+	return urls
+}
+
+// TestRebalance checks that the pending urls are handed over to the nodes that join and from the nodes that leave.
+func TestRebalance(t *testing.T) {
+	blocked := make(chan struct{})
+	blockers := newSites(t, 8, func(w http.ResponseWriter, r *http.Request) { <-blocked })
+	// released on failure as well, so that the sites can be closed
+	release := sync.OnceFunc(func() { close(blocked) })
+	t.Cleanup(release)
+	sites := newSites(t, 8, nil)
+
+	// blockers keeping the workers of every node busy, so that the sites stay pending
+	ring := NewRing(DefaultReplicas)
+	ring.Add("node-0")
+	ring.Add("node-1")
+	blocking := make(map[string]string)
+	for _, url := range blockers {
+		owner, _ := ring.Owner(scraper.HostOf(url))
+		blocking[owner] = url
+	}
+	if len(blocking) != 2 {
+		t.Fatalf("unexpected owners of blockers %v", blocking)
+	}
+
+	rec := &recorder{scrapes: make(map[string][]string)}
+	coordinator := newTestNode(t, "node-0", threads, rec)
+	if err := coordinator.Submit(context.Background(), append(blockingURLs(blocking["node-0"]), sites...)); err != nil {
+		t.Fatal(err)
+	}
+	joined := newTestNode(t, "node-1", threads, rec)
+	if err := joined.Join(context.Background(), coordinator.Membership().Members[0].Addr); err != nil {
+		t.Fatal(err)
+	}
+	var moved []string
+	for _, url := range sites {
+		if coordinator.Owner(url).ID == joined.ID() {
+			moved = append(moved, url)
+		}
+	}
+	if len(moved) == 0 {
+		t.Fatal("no host moved to the joined node")
+	}
+	scrapes := rec.wait(t, len(moved))
+	for _, url := range moved {
+		if by := scrapes[url]; len(by) != 1 || by[0] != joined.ID() {
+			t.Fatalf("%v scraped by %v, want %v", url, by, joined.ID())
+		}
+	}
+
+	others := newSites(t, 8, nil)
+	var kept []string
+	for _, url := range others {
+		if joined.Owner(url).ID == joined.ID() {
+			kept = append(kept, url)
+		}
+	}
+	if err := joined.Submit(context.Background(), append(blockingURLs(blocking["node-1"]), others...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := joined.Leave(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	scrapes = rec.wait(t, 2*threads+len(sites)+len(others))
+	for _, url := range kept {
+		if by := scrapes[url]; len(by) != 1 || by[0] != coordinator.ID() {
+			t.Fatalf("%v scraped by %v, want %v", url, by, coordinator.ID())
+		}
+	}
+	if members := coordinator.Membership().Members; len(members) != 1 {
+		t.Fatalf("unexpected members %v", members)
+	}
+}
+
+// TestLeaveClose checks that the urls handed over by the leaving node reach the remaining member even if the node is closed right away.
+func TestLeaveClose(t *testing.T) {
+	blocked := make(chan struct{})
+	blockers := newSites(t, 8, func(w http.ResponseWriter, r *http.Request) { <-blocked })
+	release := sync.OnceFunc(func() { close(blocked) })
+	t.Cleanup(release)
+	sites := newSites(t, 8, nil)
+
+	ring := NewRing(DefaultReplicas)
+	ring.Add("node-0")
+	ring.Add("node-1")
+	var blocker string
+	for _, url := range blockers {
+		if owner, _ := ring.Owner(scraper.HostOf(url)); owner == "node-1" {
+			blocker = url
+			break
+		}
+	}
+	if blocker == "" {
+		t.Fatal("no blocker owned by the leaving node")
+	}
+
+	rec := &recorder{scrapes: make(map[string][]string)}
+	// slow forwarding, so that the hand-over is still running when the leaving node is closed
+	logger := log.NewLogger(log.Warn, io.Discard)
+	srv := httptest.NewUnstartedServer(nil)
+	scrapper := scraper.NewScrapper(logger).WithThreads(threads)
+	coordinator := NewNode(Member{ID: "node-0", Addr: "http://" + srv.Listener.Addr().String()}, scrapper, logger).WithAnalyzers(rec.analyzer("node-0"))
+	var forwarded atomic.Int64
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/urls" {
+			coordinator.Handler().ServeHTTP(w, r)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		coordinator.Handler().ServeHTTP(w, r)
+		forwarded.Add(1)
+	})
+	srv.Start()
+	scrapper.Start()
+	t.Cleanup(func() {
+		coordinator.Close()
+		scrapper.Stop()
+		srv.Close()
+	})
+	leaving := newTestNode(t, "node-1", threads, rec)
+	if err := leaving.Join(context.Background(), coordinator.Membership().Members[0].Addr); err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, url := range sites {
+		if leaving.Owner(url).ID == leaving.ID() {
+			kept = append(kept, url)
+		}
+	}
+	if len(kept) == 0 {
+		t.Fatal("no site owned by the leaving node")
+	}
+	if err := leaving.Submit(context.Background(), append(blockingURLs(blocker), kept...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := leaving.Leave(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	leaving.Close()
+	if forwarded.Load() == 0 {
+		t.Fatal("node closed before handing over its urls")
+	}
+	release()
+
+	// blockers finish on the leaving node once released
+	scrapes := rec.wait(t, len(kept)+threads)
+	for _, url := range kept {
+		if by := scrapes[url]; len(by) != 1 || by[0] != coordinator.ID() {
+			t.Fatalf("%v scraped by %v, want %v", url, by, coordinator.ID())
+		}
+	}
+}
+
+// blockedTarget is a target with a full backlog, blocking until the scrape is cancelled.
+type blockedTarget struct{}
+
+func (blockedTarget) ScrapeMultiContext(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*scraper.JobHandle, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestForwardAccepted(t *testing.T) {
+	node := NewNode(Member{ID: "node-1"}, blockedTarget{}, log.NewLogger(log.Warn, io.Discard))
+	srv := httptest.NewServer(node.Handler())
+	defer srv.Close()
+
+	post := func() int {
+		client := &http.Client{Timeout: time.Second}
+		resp, err := client.Post(srv.URL+"/urls", "application/json", strings.NewReader(`{"urls": ["http://example.com"], "hops": 1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// the full backlog doesn't hold the sender
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("unexpected status %v", code)
+	}
+	node.Close()
+	if code := post(); code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status of closed node %v", code)
+	}
+}
@@ -0,0 +1,101 @@
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the default amount of virtual points of every member on the ring.
+const DefaultReplicas = 64
+
+// Ring assigns keys to members by consistent hashing. Every member owns several virtual points on the ring,
+// so that the keys are spread evenly and adding or removing a member moves only the keys of its neighbours.
+// Ring is not safe for concurrent use.
+type Ring struct {
+	replicas int
+	points   []uint64          // sorted virtual points
+	owners   map[uint64]string // owner of the virtual point
+	members  map[string]struct{}
+}
+
+// NewRing creates an empty ring with the given amount of virtual points per member.
+func NewRing(replicas int) *Ring {
+	if replicas < 1 {
+		replicas = DefaultReplicas
+	}
+	return &Ring{
+		replicas: replicas,
+		owners:   make(map[uint64]string),
+		members:  make(map[string]struct{}),
+	}
+}
+
+// Add adds the member to the ring.
+func (r *Ring) Add(member string) {
+	if _, ok := r.members[member]; ok {
+		return
+	}
+	r.members[member] = struct{}{}
+	for i := 0; i < r.replicas; i++ {
+		point := hash(member + "#" + strconv.Itoa(i))
+		// collisions are resolved in favour of the smaller id, so that every ring with the same members agrees
+		if owner, ok := r.owners[point]; ok && owner < member {
+			continue
+		} else if !ok {
+			r.points = append(r.points, point)
+		}
+		r.owners[point] = member
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove removes the member from the ring.
+func (r *Ring) Remove(member string) {
+	if _, ok := r.members[member]; !ok {
+		return
+	}
+	delete(r.members, member)
+	// rebuilt, so that the points lost by the remaining members on collisions are reclaimed
+	remaining := r.Members()
+	r.points, r.owners, r.members = nil, make(map[uint64]string), make(map[string]struct{})
+	for _, other := range remaining {
+		r.Add(other)
+	}
+}
+
+// Owner returns the member owning the key, or false if the ring is empty.
+func (r *Ring) Owner(key string) (string, bool) {
+	if len(r.points) == 0 {
+		return "", false
+	}
+	point := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]], true
+}
+
+// Members returns the sorted members of the ring.
+func (r *Ring) Members() []string {
+	members := make([]string, 0, len(r.members))
+	for member := range r.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// hash hashes the key with fnv-1a, mixed with the murmur3 finalizer, because fnv alone spreads similar keys poorly.
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
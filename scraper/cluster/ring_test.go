@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	ring := NewRing(DefaultReplicas)
+	if _, ok := ring.Owner("go.dev"); ok {
+		t.Fatal("empty ring owns a key")
+	}
+	for _, member := range []string{"a", "b", "c"} {
+		ring.Add(member)
+	}
+
+	keys := make([]string, 3000)
+	owners := make(map[string]string, len(keys))
+	counts := make(map[string]int)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("host-%v.com", i)
+		owner, _ := ring.Owner(keys[i])
+		owners[keys[i]] = owner
+		counts[owner]++
+	}
+	for member, count := range counts {
+		if count < len(keys)/6 {
+			t.Fatalf("uneven distribution, %v owns %v of %v keys", member, count, len(keys))
+		}
+	}
+
+	// only the keys of the new member move
+	ring.Add("d")
+	moved := 0
+	for _, key := range keys {
+		owner, _ := ring.Owner(key)
+		if owner != owners[key] {
+			if owner != "d" {
+				t.Fatalf("key %v moved from %v to %v", key, owners[key], owner)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > len(keys)/2 {
+		t.Fatalf("unexpected amount of moved keys %v", moved)
+	}
+
+	// removal restores the previous owners
+	ring.Remove("d")
+	for _, key := range keys {
+		if owner, _ := ring.Owner(key); owner != owners[key] {
+			t.Fatalf("key %v owned by %v after removal, want %v", key, owner, owners[key])
+		}
+	}
+	if members := ring.Members(); len(members) != 3 {
+		t.Fatalf("unexpected members %v", members)
+	}
+}
@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrContentDuplicate is the error of jobs whose body is identical to the body already served by another url.
+var ErrContentDuplicate = fmt.Errorf("%w content served by another url", ErrDuplicate)
+
+// WithContentDedup enables deduplication of the pages by their content. Bodies of the pages are hashed and pages
+// whose body was already served by another url of the session are dropped with ErrContentDuplicate, so that identical
+// content is analyzed once. Deduplication is disabled by default.
+func (s *Scrapper) WithContentDedup() *Scrapper {
+	s.contentDedup = true
+	return s
+}
+
+// ContentHash returns the hash of the body, normalized so that differences in whitespace don't count.
+func ContentHash(body string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(body), " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentURLs returns the urls that served the body of the page so far, starting with the one it was analyzed through.
+// Returns nil if the scrapper doesn't deduplicate the content.
+func (p *Page) ContentURLs() []string {
+	if p.contents == nil {
+		return nil
+	}
+	return p.contents.urls(p.ContentHash)
+}
+
+// dedupContent hashes the body of the page and returns the error the job should be dropped with, if any.
+func (s *Scrapper) dedupContent(target scrapeTarget, page *Page) error {
+	if !s.contentDedup {
+		return nil
+	}
+	page.ContentHash = ContentHash(page.Body)
+	page.contents = &target.session.contents
+	if !page.contents.claim(page.ContentHash, target.url) {
+		return ErrContentDuplicate
+	}
+	return nil
+}
+
+// contents is the content-addressed seen set of a session, mapping the hashes of the bodies to the urls serving them.
+type contents struct {
+	mu     sync.Mutex
+	hashes map[string][]string
+}
+
+// claim records that the url served the content. Returns false if the content was first served by another url.
+func (c *contents) claim(hash, url string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hashes == nil {
+		c.hashes = make(map[string][]string)
+	}
+	urls := c.hashes[hash]
+	known := false
+	for _, u := range urls {
+		known = known || u == url
+	}
+	if !known {
+		c.hashes[hash] = append(urls, url)
+	}
+	return len(urls) == 0 || urls[0] == url
+}
+
+// urls returns the urls that served the content, in the order they were scraped.
+func (c *contents) urls(hash string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.hashes[hash]...)
+}
@@ -0,0 +1,66 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentDedup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/", "/index.html":
+			io.WriteString(w, "<p>home</p>\n")
+		case "/home":
+			io.WriteString(w, "  <p>home</p>")
+		default:
+			io.WriteString(w, "<p>other</p>")
+		}
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(2).WithContentDedup().WithResults(8)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, path := range []string{"/", "/index.html", "/home", "/other"} {
+		analyzer := &testingCallbackAnalyzer{}
+		handle, err := scrapper.ScrapeContext(ctx, server.URL+path, analyzer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle.Wait(ctx)
+		if path == "/index.html" || path == "/home" {
+			if handle.Status() != JobDropped || !errors.Is(handle.Err(), ErrContentDuplicate) || !errors.Is(analyzer.err, ErrDuplicate) {
+				t.Fatalf("duplicate content of %v analyzed. status %v, err %v", path, handle.Status(), handle.Err())
+			}
+			continue
+		}
+		if handle.Status() != JobDone || analyzer.page == "" {
+			t.Fatalf("unexpected job outcome of %v. status %v, err %v", path, handle.Status(), handle.Err())
+		}
+	}
+
+	// results of every url report all of the urls serving the content
+	want := server.URL + "/," + server.URL + "/index.html," + server.URL + "/home"
+	for i := 0; i < 4; i++ {
+		result := <-scrapper.Results()
+		urls := strings.Join(result.Page.ContentURLs(), ",")
+		if result.URL == server.URL+"/other" {
+			if urls != result.URL {
+				t.Fatalf("unexpected content urls %v", urls)
+			}
+			continue
+		}
+		if urls != want || result.Page.ContentHash != ContentHash("<p>home</p>") {
+			t.Fatalf("unexpected content urls of %v: %v", result.URL, urls)
+		}
+	}
+}
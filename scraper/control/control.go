@@ -0,0 +1,67 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Exca-DK/webscraper/scraper"
+)
+
+var _ Target = (*scraper.Scrapper)(nil)
+
+// Target is the set of operations exposed to the operators of a live crawl.
+type Target interface {
+	SetThreads(num int)
+	Threads() int
+	Stats() scraper.Stats
+}
+
+// threadsRequest is the body of a request changing the number of threads.
+type threadsRequest struct {
+	Threads int `json:"threads"`
+}
+
+// NewHandler returns http.Handler exposing the target over a json api:
+//
+//	GET /stats    returns the current load of the target
+//	GET /threads  returns the configured number of threads
+//	PUT /threads  changes the number of threads, eg. {"threads": 8}
+func NewHandler(target Target) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		WriteJSON(w, target.Stats())
+	})
+	mux.HandleFunc("/threads", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var req threadsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if req.Threads < 1 {
+				http.Error(w, "threads must be positive", http.StatusBadRequest)
+				return
+			}
+			target.SetThreads(req.Threads)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		WriteJSON(w, threadsRequest{Threads: target.Threads()})
+	})
+	return mux
+}
+
+// WriteJSON writes v as the json response, or an internal error if v can't be encoded.
+func WriteJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
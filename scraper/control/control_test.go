@@ -0,0 +1,58 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Exca-DK/webscraper/scraper"
+)
+
+type testingTarget struct {
+	threads int
+}
+
+func (t *testingTarget) SetThreads(num int)   { t.threads = num }
+func (t *testingTarget) Threads() int         { return t.threads }
+func (t *testingTarget) Stats() scraper.Stats { return scraper.Stats{Threads: t.threads} }
+
+func TestHandler(t *testing.T) {
+	target := &testingTarget{threads: 1}
+	srv := httptest.NewServer(NewHandler(target))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/threads", strings.NewReader(`{"threads": 4}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || target.threads != 4 {
+		t.Fatalf("threads not changed. status %v, threads %v", resp.StatusCode, target.threads)
+	}
+
+	req, _ = http.NewRequest(http.MethodPut, srv.URL+"/threads", strings.NewReader(`{"threads": 0}`))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status. got %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	resp, err = http.Get(srv.URL + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var stats scraper.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Threads != 4 {
+		t.Fatalf("unexpected stats. got %+v", stats)
+	}
+}
@@ -0,0 +1,179 @@
+package scraper
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DeadLetter represents a target that failed permanently, after exhausting all of its fetch attempts.
+type DeadLetter struct {
+	URL       string    `json:"url"`
+	Session   string    `json:"session"`
+	Err       string    `json:"err"` // last error of the target
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"` // time of the submission
+	FailedAt  time.Time `json:"failedAt"`  // time of the last failure
+}
+
+// DeadLetterStore is an interface for keeping permanently failed targets until they are re-submitted.
+// Targets are identified by their url, so a new failure of the url replaces the previous one.
+type DeadLetterStore interface {
+	// Add records the failed target.
+	Add(DeadLetter) error
+	// List returns the failed targets ordered by the time of the failure.
+	List() ([]DeadLetter, error)
+	// Remove removes the failed targets of the urls.
+	Remove(urls ...string) error
+}
+
+// MemoryDeadLetterStore is a DeadLetterStore that keeps failed targets in memory.
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	letters map[string]DeadLetter
+}
+
+// NewMemoryDeadLetterStore returns empty in memory DeadLetterStore.
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{letters: make(map[string]DeadLetter)}
+}
+
+// Implements DeadLetterStore.Add
+func (m *MemoryDeadLetterStore) Add(letter DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.letters[letter.URL] = letter
+	return nil
+}
+
+// Implements DeadLetterStore.List
+func (m *MemoryDeadLetterStore) List() ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	letters := make([]DeadLetter, 0, len(m.letters))
+	for _, letter := range m.letters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].FailedAt.Before(letters[j].FailedAt) })
+	return letters, nil
+}
+
+// Implements DeadLetterStore.Remove
+func (m *MemoryDeadLetterStore) Remove(urls ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, url := range urls {
+		delete(m.letters, url)
+	}
+	return nil
+}
+
+// FileDeadLetterStore is a DeadLetterStore that keeps failed targets as a json file on the disk.
+// The file is rewritten atomically on every change.
+type FileDeadLetterStore struct {
+	path string
+	mu   sync.Mutex // mutex serializing the file access
+}
+
+// NewFileDeadLetterStore returns DeadLetterStore that keeps failed targets in the file under the path.
+func NewFileDeadLetterStore(path string) *FileDeadLetterStore {
+	return &FileDeadLetterStore{path: path}
+}
+
+// Implements DeadLetterStore.Add
+func (f *FileDeadLetterStore) Add(letter DeadLetter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+	store.Add(letter)
+	return f.save(store)
+}
+
+// Implements DeadLetterStore.List
+func (f *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	store, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return store.List()
+}
+
+// Implements DeadLetterStore.Remove
+func (f *FileDeadLetterStore) Remove(urls ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	store, err := f.load()
+	if err != nil {
+		return err
+	}
+	store.Remove(urls...)
+	return f.save(store)
+}
+
+// load reads the file into memory store. Missing file means that there are no failed targets.
+func (f *FileDeadLetterStore) load() (*MemoryDeadLetterStore, error) {
+	store := NewMemoryDeadLetterStore()
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return nil, err
+	}
+	for _, letter := range letters {
+		store.Add(letter)
+	}
+	return store, nil
+}
+
+// save writes the memory store to the file.
+func (f *FileDeadLetterStore) save(store *MemoryDeadLetterStore) error {
+	letters, _ := store.List()
+	data, err := json.MarshalIndent(letters, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// ExportDeadLetters writes the failed targets to w in the format, either "json" or "csv".
+func ExportDeadLetters(w io.Writer, letters []DeadLetter, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(letters)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"url", "session", "err", "attempts", "createdAt", "failedAt"})
+		for _, letter := range letters {
+			writer.Write([]string{
+				letter.URL,
+				letter.Session,
+				letter.Err,
+				strconv.Itoa(letter.Attempts),
+				letter.CreatedAt.Format(time.RFC3339),
+				letter.FailedAt.Format(time.RFC3339),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
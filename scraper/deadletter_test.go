@@ -0,0 +1,154 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestFileDeadLetterStore checks that failed targets are kept, replaced, removed and exported.
+func TestFileDeadLetterStore(t *testing.T) {
+	store := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead.json"))
+	if letters, err := store.List(); err != nil || len(letters) != 0 {
+		t.Fatalf("unexpected empty store. got %v, %v", letters, err)
+	}
+
+	now := time.Now()
+	for _, letter := range []DeadLetter{
+		{URL: "a", Err: "first", Attempts: 1, FailedAt: now},
+		{URL: "b", Err: "second", Attempts: 1, FailedAt: now.Add(time.Second)},
+		{URL: "a", Err: "third", Attempts: 2, FailedAt: now.Add(2 * time.Second)},
+	} {
+		if err := store.Add(letter); err != nil {
+			t.Fatal(err)
+		}
+	}
+	letters, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 || letters[0].URL != "b" || letters[1].Err != "third" {
+		t.Fatalf("unexpected letters %+v", letters)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportDeadLetters(&buf, letters, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 {
+		t.Fatalf("unexpected csv export %q", buf.String())
+	}
+	if err := ExportDeadLetters(&buf, letters, "xml"); err == nil {
+		t.Fatal("exported unknown format")
+	}
+
+	if err := store.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if letters, err := store.List(); err != nil || len(letters) != 1 {
+		t.Fatalf("unexpected letters after removal. got %v, %v", letters, err)
+	}
+}
+
+// TestDeadLetters checks that targets are fetched again until they run out of attempts,
+// recorded as dead letters and scraped again once re-submitted.
+func TestDeadLetters(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if failing.Load() {
+			// abort the connection, failing the fetch
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1).WithMaxAttempts(2)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	url := server.URL + "/page"
+	handle, err := scrapper.ScrapeContext(ctx, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle.Wait(ctx)
+	if handle.Status() != JobFailed || fetches.Load() != 2 {
+		t.Fatalf("unexpected job outcome. status %v, fetches %v", handle.Status(), fetches.Load())
+	}
+	letters, err := scrapper.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].URL != url || letters[0].Attempts != 2 {
+		t.Fatalf("unexpected letters %+v", letters)
+	}
+
+	failing.Store(false)
+	handles, err := scrapper.ResubmitDeadLetters(ctx, []string{url}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handles[0].Wait(ctx)
+	if handles[0].Status() != JobDone {
+		t.Fatalf("unexpected status of re-submitted job. got %v, want %v", handles[0].Status(), JobDone)
+	}
+	if letters, _ := scrapper.DeadLetters(); len(letters) != 0 {
+		t.Fatalf("unexpected letters after re-submission %+v", letters)
+	}
+}
+
+// TestRetryableStatus checks that 5xx and 429 responses are failed attempts, retried and recorded as dead letters.
+func TestRetryableStatus(t *testing.T) {
+	var flaky atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/flaky" && flaky.Add(1) == 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case r.URL.Path == "/down":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1).WithMaxAttempts(2)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	handles, err := scrapper.ScrapeMultiContext(ctx, []string{server.URL + "/flaky", server.URL + "/down"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, handle := range handles {
+		handle.Wait(ctx)
+	}
+	if handles[0].Status() != JobDone || flaky.Load() != 2 {
+		t.Fatalf("unexpected outcome of retried job. status %v, fetches %v", handles[0].Status(), flaky.Load())
+	}
+	if handles[1].Status() != JobFailed || !errors.Is(handles[1].Err(), ErrRetryableStatus) {
+		t.Fatalf("unexpected outcome of failing job. status %v, err %v", handles[1].Status(), handles[1].Err())
+	}
+	if page := handles[1].Page(); page == nil || page.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected page of failing job %+v", page)
+	}
+	letters, err := scrapper.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].URL != server.URL+"/down" || letters[0].Attempts != 2 {
+		t.Fatalf("unexpected letters %+v", letters)
+	}
+}
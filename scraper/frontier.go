@@ -0,0 +1,198 @@
+package scraper
+
+import "github.com/Exca-DK/webscraper/scraper/prims"
+
+// dispatchOutcome is the outcome of handing a waiting target over to a worker.
+type dispatchOutcome int
+
+const (
+	dispatched dispatchOutcome = iota // target handed over to a worker, using up one of the targets of the turn of its host
+	removed                           // target left the frontier without a worker, eg. dropped as a duplicate
+	blocked                           // target stays, its host can't take more targets right now
+	stopped                           // target stays, no worker can take more targets right now
+)
+
+// frontier holds the targets waiting for a worker in per host queues. The queues are served round-robin,
+// so that every host makes progress no matter how many targets the other hosts have. Accessed only by the eventLoop.
+//
+// The order doesn't override the turns of the hosts: it orders the targets within the queue of each session of a host only,
+// so a host with low priority targets takes its turn even while the other hosts wait with higher priority ones.
+type frontier struct {
+	weight func(host string) int        // targets served per turn of the host, 1 if nil
+	order  func(targets []scrapeTarget) // orders the targets of a session queue, nil keeps the arrival order
+
+	queues map[string]*hostQueue
+	hosts  []string // hosts with waiting targets, in the round-robin order
+	next   int      // index of the host taking the next turn
+	served int      // targets served in the current turn
+	size   int
+}
+
+func newFrontier(weight func(host string) int, order func(targets []scrapeTarget)) *frontier {
+	return &frontier{
+		weight: weight,
+		order:  order,
+		queues: make(map[string]*hostQueue),
+	}
+}
+
+// push adds the targets to the queues of their hosts. New hosts take their turn after the hosts already waiting.
+func (f *frontier) push(targets []scrapeTarget) {
+	touched := make(map[*prims.Queue[scrapeTarget]]struct{})
+	for _, target := range targets {
+		host := HostOf(target.url)
+		queue, ok := f.queues[host]
+		if !ok {
+			queue = newHostQueue()
+			f.queues[host] = queue
+			f.hosts = append(f.hosts, host)
+		}
+		touched[queue.push(target)] = struct{}{}
+		f.size++
+	}
+	if f.order == nil {
+		return
+	}
+	for queue := range touched {
+		f.order(*queue)
+	}
+}
+
+// reorder orders the targets of every session queue again, eg. after their priorities changed.
+func (f *frontier) reorder() {
+	if f.order == nil {
+		return
+	}
+	for _, queue := range f.queues {
+		for _, sessionQueue := range queue.queues {
+			f.order(*sessionQueue)
+		}
+	}
+}
+
+// serve hands the waiting targets to dispatch, the hosts taking turns and the sessions of the host taking turns within them. Serving stops once dispatch reports
+// that no worker is free, or every host with waiting targets is blocked. The turn interrupted by a busy worker
+// continues with the next serve.
+func (f *frontier) serve(dispatch func(target scrapeTarget) dispatchOutcome) {
+	skipped := make(map[string]struct{})
+	for len(skipped) < len(f.hosts) {
+		if f.next >= len(f.hosts) {
+			f.next = 0
+		}
+		host := f.hosts[f.next]
+		if _, ok := skipped[host]; ok {
+			f.next++
+			continue
+		}
+		queue := f.queues[host]
+	TURN:
+		for f.served < f.weightOf(host) {
+			target, ok := queue.peek()
+			if !ok {
+				break
+			}
+			switch dispatch(target) {
+			case stopped:
+				return
+			case blocked:
+				skipped[host] = struct{}{}
+				break TURN
+			case dispatched:
+				f.served++
+			}
+			queue.pop()
+			f.size--
+		}
+		f.served = 0
+		if queue.size > 0 {
+			f.next++
+			continue
+		}
+		// the next host takes the index of the removed one
+		delete(f.queues, host)
+		f.hosts = append(f.hosts[:f.next], f.hosts[f.next+1:]...)
+	}
+}
+
+// weightOf returns the amount of targets served per turn of the host.
+func (f *frontier) weightOf(host string) int {
+	if f.weight == nil {
+		return 1
+	}
+	return max(1, f.weight(host))
+}
+
+// len returns the amount of waiting targets.
+func (f *frontier) len() int { return f.size }
+
+// targets returns the waiting targets, host by host.
+func (f *frontier) targets() []scrapeTarget {
+	targets := make([]scrapeTarget, 0, f.size)
+	for _, host := range f.hosts {
+		targets = f.queues[host].appendTargets(targets)
+	}
+	return targets
+}
+
+// hostQueue holds the waiting targets of a single host in per session queues. The sessions take turns target by target,
+// so that a big session doesn't starve the other sessions crawling the same host.
+type hostQueue struct {
+	queues   map[*Session]*prims.Queue[scrapeTarget]
+	sessions []*Session // sessions with waiting targets, in the round-robin order
+	next     int        // index of the session serving the next target
+	size     int
+}
+
+func newHostQueue() *hostQueue {
+	return &hostQueue{queues: make(map[*Session]*prims.Queue[scrapeTarget])}
+}
+
+// push adds the target to the queue of its session and returns that queue.
+func (q *hostQueue) push(target scrapeTarget) *prims.Queue[scrapeTarget] {
+	queue, ok := q.queues[target.session]
+	if !ok {
+		queue = &prims.Queue[scrapeTarget]{}
+		q.queues[target.session] = queue
+		q.sessions = append(q.sessions, target.session)
+	}
+	queue.Push(target)
+	q.size++
+	return queue
+}
+
+// peek returns the next target of the session taking its turn.
+func (q *hostQueue) peek() (scrapeTarget, bool) {
+	if q.size == 0 {
+		return scrapeTarget{}, false
+	}
+	if q.next >= len(q.sessions) {
+		q.next = 0
+	}
+	return q.queues[q.sessions[q.next]].Peek()
+}
+
+// pop removes the target returned by peek and passes the turn to the next session.
+func (q *hostQueue) pop() {
+	if _, ok := q.peek(); !ok {
+		return
+	}
+	session := q.sessions[q.next]
+	queue := q.queues[session]
+	queue.Pop()
+	q.size--
+	if len(*queue) > 0 {
+		q.next++
+		return
+	}
+	// the next session takes the index of the removed one
+	delete(q.queues, session)
+	q.sessions = append(q.sessions[:q.next], q.sessions[q.next+1:]...)
+}
+
+// appendTargets appends the waiting targets to targets, session by session.
+func (q *hostQueue) appendTargets(targets []scrapeTarget) []scrapeTarget {
+	for _, session := range q.sessions {
+		targets = append(targets, *q.queues[session]...)
+	}
+	return targets
+}
@@ -0,0 +1,183 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrontier(t *testing.T) {
+	targets := func(host string, n int) []scrapeTarget {
+		targets := make([]scrapeTarget, n)
+		for i := range targets {
+			targets[i] = scrapeTarget{url: fmt.Sprintf("http://%v/%d", host, i)}
+		}
+		return targets
+	}
+	f := newFrontier(func(host string) int {
+		if host == "heavy" {
+			return 2
+		}
+		return 1
+	}, nil)
+	f.push(targets("a", 4))
+	f.push(targets("heavy", 4))
+	f.push(targets("b", 1))
+
+	var served []string
+	serve := func(limit int, outcome func(target scrapeTarget) dispatchOutcome) {
+		served = served[:0]
+		f.serve(func(target scrapeTarget) dispatchOutcome {
+			if len(served) == limit {
+				return stopped
+			}
+			if result := outcome(target); result != dispatched {
+				return result
+			}
+			served = append(served, strings.TrimPrefix(target.url, "http://"))
+			return dispatched
+		})
+	}
+	always := func(scrapeTarget) dispatchOutcome { return dispatched }
+
+	// interrupted turns continue with the next serve
+	serve(2, always)
+	if strings.Join(served, ",") != "a/0,heavy/0" {
+		t.Fatalf("unexpected order %v", served)
+	}
+	serve(4, always)
+	if strings.Join(served, ",") != "heavy/1,b/0,a/1,heavy/2" {
+		t.Fatalf("unexpected order %v", served)
+	}
+
+	// blocked hosts are skipped, removed targets don't use up the turn
+	serve(10, func(target scrapeTarget) dispatchOutcome {
+		switch {
+		case strings.Contains(target.url, "heavy"):
+			return blocked
+		case target.url == "http://a/2":
+			return removed
+		}
+		return dispatched
+	})
+	if strings.Join(served, ",") != "a/3" || f.len() != 1 {
+		t.Fatalf("unexpected order %v, %d left", served, f.len())
+	}
+	if left := f.targets(); len(left) != 1 || left[0].url != "http://heavy/3" {
+		t.Fatalf("unexpected targets left %+v", left)
+	}
+	serve(10, always)
+	if strings.Join(served, ",") != "heavy/3" || f.len() != 0 || len(f.hosts) != 0 {
+		t.Fatalf("unexpected order %v", served)
+	}
+}
+
+// TestFairness checks that a host with few targets isn't held back by a host with many of them.
+func TestFairness(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	// the first target of the big host holds the only worker until the small host's targets are submitted
+	gate := make(chan struct{})
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/0" {
+				<-gate
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		})
+	}
+	big := httptest.NewServer(handler("big"))
+	defer big.Close()
+	small := httptest.NewServer(handler("small"))
+	defer small.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	urls := make([]string, 50)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%v/%d", big.URL, i)
+	}
+	handles, err := scrapper.ScrapeMultiContext(ctx, urls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallHandles, err := scrapper.ScrapeMultiContext(ctx, []string{small.URL + "/a", small.URL + "/b"}, nil)
+	close(gate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, handle := range append(handles, smallHandles...) {
+		if err := handle.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	last := 0
+	for i, name := range order {
+		if name == "small" {
+			last = i
+		}
+	}
+	// the big host's targets already waiting for the worker go first, then the hosts take turns
+	if len(order) != 52 || last > 5 {
+		t.Fatalf("small host served late, at %d of %d", last, len(order))
+	}
+}
+
+// TestFrontierSessions checks that the sessions sharing a host take turns within its queue.
+func TestFrontierSessions(t *testing.T) {
+	a, b := &Session{name: "a"}, &Session{name: "b"}
+	f := newFrontier(func(host string) int { return 2 }, nil)
+	f.push([]scrapeTarget{
+		{url: "http://host/a1", session: a},
+		{url: "http://host/a2", session: a},
+		{url: "http://host/a3", session: a},
+		{url: "http://host/b1", session: b},
+	})
+	var served []string
+	f.serve(func(target scrapeTarget) dispatchOutcome {
+		served = append(served, strings.TrimPrefix(target.url, "http://host/"))
+		return dispatched
+	})
+	if got, want := strings.Join(served, ","), "a1,b1,a2,a3"; got != want {
+		t.Fatalf("unexpected order. got %v, want %v", got, want)
+	}
+	if f.len() != 0 || len(f.hosts) != 0 {
+		t.Fatalf("unexpected targets left %+v", f.targets())
+	}
+}
+
+// TestFrontierPriority pins that the order applies within the hosts only, the hosts take turns regardless of the priorities.
+func TestFrontierPriority(t *testing.T) {
+	priorities := map[string]float64{
+		"http://a/low": 1, "http://a/high": 9,
+		"http://b/low": 0, "http://b/mid": 5,
+	}
+	f := newFrontier(nil, func(targets []scrapeTarget) {
+		sort.SliceStable(targets, func(i, j int) bool { return priorities[targets[i].url] > priorities[targets[j].url] })
+	})
+	f.push([]scrapeTarget{{url: "http://a/low"}, {url: "http://a/high"}, {url: "http://b/low"}, {url: "http://b/mid"}})
+	var served []string
+	f.serve(func(target scrapeTarget) dispatchOutcome {
+		served = append(served, strings.TrimPrefix(target.url, "http://"))
+		return dispatched
+	})
+	// a/low goes before b/mid despite its lower priority
+	if got, want := strings.Join(served, ","), "a/high,b/mid,a/low,b/low"; got != want {
+		t.Fatalf("unexpected order. got %v, want %v", got, want)
+	}
+}
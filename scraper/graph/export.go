@@ -0,0 +1,127 @@
+package graph
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Export writes the graph to w in the format, one of dot, graphml or csv.
+func (g *Graph) Export(w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return g.WriteDOT(w)
+	case "graphml":
+		return g.WriteGraphML(w)
+	case "csv":
+		return g.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Pages are labelled with their urls, links with their anchor texts.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph links {\n")
+	for _, url := range g.Pages() {
+		depth, _ := g.Depth(url)
+		fmt.Fprintf(&b, "\t%s [depth=%d];\n", strconv.Quote(url), depth)
+	}
+	for _, edge := range g.Edges() {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s", strconv.Quote(edge.Source), strconv.Quote(edge.Target), strconv.Quote(edge.Anchor))
+		if len(edge.Rel) > 0 {
+			fmt.Fprintf(&b, ", rel=%s", strconv.Quote(strings.Join(edge.Rel, " ")))
+		}
+		b.WriteString("];\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph in the GraphML format. Pages are identified by their urls.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "depth", For: "node", Name: "depth", Type: "int"},
+			{ID: "crawled", For: "node", Name: "crawled", Type: "boolean"},
+			{ID: "anchor", For: "edge", Name: "anchor", Type: "string"},
+			{ID: "rel", For: "edge", Name: "rel", Type: "string"},
+			{ID: "edgeDepth", For: "edge", Name: "depth", Type: "int"},
+		},
+	}
+	doc.Graph.EdgeDefault = "directed"
+	for _, url := range g.Pages() {
+		depth, _ := g.Depth(url)
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: url, Data: []graphMLData{
+			{Key: "depth", Value: strconv.Itoa(depth)},
+			{Key: "crawled", Value: strconv.FormatBool(g.Crawled(url))},
+		}})
+	}
+	for _, edge := range g.Edges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{Source: edge.Source, Target: edge.Target, Data: []graphMLData{
+			{Key: "anchor", Value: edge.Anchor},
+			{Key: "rel", Value: strings.Join(edge.Rel, " ")},
+			{Key: "edgeDepth", Value: strconv.Itoa(edge.Depth)},
+		}})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteCSV writes the links of the graph as a csv edge list.
+func (g *Graph) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"source", "target", "anchor", "rel", "depth"})
+	for _, edge := range g.Edges() {
+		writer.Write([]string{edge.Source, edge.Target, edge.Anchor, strings.Join(edge.Rel, " "), strconv.Itoa(edge.Depth)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,226 @@
+package graph
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+// Edge is a link from the source page to the target url.
+type Edge struct {
+	Source string
+	Target string
+	Anchor string   // anchor text of the link
+	Rel    []string // rel attribute of the link, eg. nofollow
+	Depth  int      // crawl depth of the source page
+}
+
+// page is a node of the graph.
+type page struct {
+	depth   int
+	crawled bool     // page was scraped, not only linked
+	out     []Edge   // links of the page, in the document order
+	in      []string // sources linking to the page, in the order of discovery
+}
+
+// Graph is the store of the links discovered by a crawl. It's safe for concurrent use.
+type Graph struct {
+	mu    sync.RWMutex
+	pages map[string]*page
+}
+
+// New creates an empty graph.
+func New() *Graph {
+	return &Graph{pages: make(map[string]*page)}
+}
+
+// node returns the page of the url, creating it at the depth if it's unknown.
+func (g *Graph) node(url string, depth int) *page {
+	p, ok := g.pages[url]
+	if !ok {
+		p = &page{depth: depth}
+		g.pages[url] = p
+	}
+	return p
+}
+
+// AddRoot adds the seed url of the crawl at depth 0.
+func (g *Graph) AddRoot(url string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.node(url, 0).depth = 0
+}
+
+// AddLinks records the links of the scraped source page, replacing the ones recorded by its previous scrape.
+// Pages reached for the first time are one level deeper than the source. Unknown sources are treated as roots.
+func (g *Graph) AddLinks(source string, links []html.Link) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p := g.node(source, 0)
+	p.crawled = true
+	for _, edge := range p.out {
+		target := g.pages[edge.Target]
+		target.in = remove(target.in, source)
+	}
+	p.out = p.out[:0]
+	for _, link := range links {
+		edge := Edge{Source: source, Target: link.URL, Anchor: link.Text, Rel: link.Rel, Depth: p.depth}
+		p.out = append(p.out, edge)
+		target := g.node(link.URL, p.depth+1)
+		target.depth = min(target.depth, p.depth+1)
+		target.in = append(target.in, source)
+	}
+}
+
+// Analyzer returns analytics.Analyzer recording the links of the scraped page of the url.
+func (g *Graph) Analyzer(url string) analytics.Analyzer {
+	return &linkAnalyzer{graph: g, url: url}
+}
+
+// Depth returns the crawl depth of the url, or false if the url is unknown.
+func (g *Graph) Depth(url string) (int, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p, ok := g.pages[url]
+	if !ok {
+		return 0, false
+	}
+	return p.depth, true
+}
+
+// Outbound returns the links of the page.
+func (g *Graph) Outbound(url string) []Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p, ok := g.pages[url]
+	if !ok {
+		return nil
+	}
+	return append([]Edge(nil), p.out...)
+}
+
+// Inbound returns the links pointing to the url.
+func (g *Graph) Inbound(url string) []Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p, ok := g.pages[url]
+	if !ok {
+		return nil
+	}
+	var edges []Edge
+	for _, source := range unique(p.in) {
+		for _, edge := range g.pages[source].out {
+			if edge.Target == url {
+				edges = append(edges, edge)
+			}
+		}
+	}
+	return edges
+}
+
+// Orphans returns the sorted scraped pages that no other page links to.
+func (g *Graph) Orphans() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	var orphans []string
+	for url, p := range g.pages {
+		if !p.crawled {
+			continue
+		}
+		linked := false
+		for _, source := range p.in {
+			if source != url {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			orphans = append(orphans, url)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// Pages returns the sorted urls of the graph, including the ones that were only linked.
+func (g *Graph) Pages() []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	urls := make([]string, 0, len(g.pages))
+	for url := range g.pages {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Crawled reports whether the page of the url was scraped.
+func (g *Graph) Crawled(url string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	p, ok := g.pages[url]
+	return ok && p.crawled
+}
+
+// Edges returns all links of the graph, ordered by their source and the document order.
+func (g *Graph) Edges() []Edge {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	sources := make([]string, 0, len(g.pages))
+	for url, p := range g.pages {
+		if len(p.out) > 0 {
+			sources = append(sources, url)
+		}
+	}
+	sort.Strings(sources)
+	var edges []Edge
+	for _, source := range sources {
+		edges = append(edges, g.pages[source].out...)
+	}
+	return edges
+}
+
+// linkAnalyzer records the links of the scraped page in the graph.
+type linkAnalyzer struct {
+	graph *Graph
+	url   string
+}
+
+// Implements Analyzer.Analyze
+func (a *linkAnalyzer) Analyze(page string) {
+	links, err := html.ExtractLinks(page, a.url)
+	if err != nil {
+		return
+	}
+	a.graph.AddLinks(a.url, links)
+}
+
+// Implements Analyzer.Cancel
+func (a *linkAnalyzer) Cancel(err error) {}
+
+// remove returns the values without the value, keeping the order of the rest.
+func remove(values []string, value string) []string {
+	kept := values[:0]
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// unique returns the values without duplicates, in the order of their first occurrence.
+func unique(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		result = append(result, v)
+	}
+	return result
+}
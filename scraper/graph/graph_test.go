@@ -0,0 +1,91 @@
+package graph
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+// newTestGraph creates graph: a -> b, a -> c, b -> c (nofollow), c -> a, with d being an orphan linking to b.
+func newTestGraph() *Graph {
+	g := New()
+	g.AddRoot("a")
+	g.AddLinks("a", []html.Link{{URL: "b", Text: "to b"}, {URL: "c", Text: "to c"}})
+	g.AddLinks("b", []html.Link{{URL: "c", Text: "b to c", Rel: []string{"nofollow"}}})
+	g.AddLinks("c", []html.Link{{URL: "a", Text: "home"}})
+	g.AddLinks("d", []html.Link{{URL: "b", Text: "from d"}})
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := newTestGraph()
+
+	inbound := g.Inbound("c")
+	if len(inbound) != 2 || inbound[0].Source != "a" || inbound[1].Source != "b" || inbound[1].Rel[0] != "nofollow" {
+		t.Fatalf("unexpected inbound links %+v", inbound)
+	}
+	if depth, _ := g.Depth("c"); depth != 1 {
+		t.Fatalf("unexpected depth %v", depth)
+	}
+	if orphans := g.Orphans(); len(orphans) != 1 || orphans[0] != "d" {
+		t.Fatalf("unexpected orphans %v", orphans)
+	}
+
+	// rescrape replaces the links of the page
+	g.AddLinks("a", []html.Link{{URL: "b", Text: "to b"}})
+	if inbound := g.Inbound("c"); len(inbound) != 1 || inbound[0].Source != "b" {
+		t.Fatalf("unexpected inbound links after rescrape %+v", inbound)
+	}
+	if outbound := g.Outbound("a"); len(outbound) != 1 {
+		t.Fatalf("unexpected outbound links %+v", outbound)
+	}
+
+	analyzer := g.Analyzer("https://example.com/")
+	analyzer.Analyze(`<a href="/x">x</a>`)
+	if inbound := g.Inbound("https://example.com/x"); len(inbound) != 1 || inbound[0].Anchor != "x" {
+		t.Fatalf("unexpected inbound links %+v", inbound)
+	}
+}
+
+func TestExport(t *testing.T) {
+	g := newTestGraph()
+
+	var dot strings.Builder
+	if err := g.Export(&dot, "dot"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(dot.String(), "digraph links {") || !strings.Contains(dot.String(), `"b" -> "c" [label="b to c", rel="nofollow"];`) {
+		t.Fatalf("unexpected dot %v", dot.String())
+	}
+
+	var graphml strings.Builder
+	if err := g.Export(&graphml, "graphml"); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err := xml.Unmarshal([]byte(graphml.String()), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Graph.Nodes) != 4 || len(doc.Graph.Edges) != 5 {
+		t.Fatalf("unexpected graphml %v", graphml.String())
+	}
+
+	var edges strings.Builder
+	if err := g.Export(&edges, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(strings.NewReader(edges.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 6 || strings.Join(records[1], ",") != "a,b,to b,,0" {
+		t.Fatalf("unexpected csv %v", records)
+	}
+
+	if err := g.Export(&edges, "pdf"); err == nil {
+		t.Fatal("exported unknown format")
+	}
+}
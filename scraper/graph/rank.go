@@ -0,0 +1,208 @@
+package graph
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RankConfig configures the iterative link analysis.
+type RankConfig struct {
+	Damping        float64 // probability of following a link in PageRank, 0.85 if zero
+	Tolerance      float64 // iterations stop once the scores change by less in total, 1e-6 if zero
+	MaxIterations  int     // upper bound of the iterations, 100 if zero
+	IgnoreNofollow bool    // skips the links with rel=nofollow
+}
+
+func (cfg RankConfig) withDefaults() RankConfig {
+	if cfg.Damping <= 0 || cfg.Damping >= 1 {
+		cfg.Damping = 0.85
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 1e-6
+	}
+	if cfg.MaxIterations <= 0 {
+		cfg.MaxIterations = 100
+	}
+	return cfg
+}
+
+// adjacency is the graph in the form used by the link analysis.
+// Every page is identified by its index, multiple links between the same pages and links to itself are counted once.
+type adjacency struct {
+	urls []string
+	out  [][]int
+	in   [][]int
+}
+
+// adjacency returns the snapshot of the graph for the link analysis.
+func (g *Graph) adjacency(ignoreNofollow bool) adjacency {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	index := make(map[string]int, len(g.pages))
+	a := adjacency{urls: make([]string, 0, len(g.pages))}
+	for url := range g.pages {
+		index[url] = len(a.urls)
+		a.urls = append(a.urls, url)
+	}
+	a.out, a.in = make([][]int, len(a.urls)), make([][]int, len(a.urls))
+	for i, url := range a.urls {
+		linked := make(map[int]struct{})
+		for _, edge := range g.pages[url].out {
+			j := index[edge.Target]
+			if _, ok := linked[j]; ok || j == i || (ignoreNofollow && hasRel(edge.Rel, "nofollow")) {
+				continue
+			}
+			linked[j] = struct{}{}
+			a.out[i] = append(a.out[i], j)
+			a.in[j] = append(a.in[j], i)
+		}
+	}
+	return a
+}
+
+// PageRank computes the PageRank of the pages of the graph, summing up to 1.
+// Rank of the pages without links, including the ones that were only linked, is spread evenly over all pages.
+func (g *Graph) PageRank(cfg RankConfig) map[string]float64 {
+	cfg = cfg.withDefaults()
+	a := g.adjacency(cfg.IgnoreNofollow)
+	n := len(a.urls)
+	if n == 0 {
+		return map[string]float64{}
+	}
+	rank, next := make([]float64, n), make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+	for iteration := 0; iteration < cfg.MaxIterations; iteration++ {
+		dangling := 0.0
+		for i := range rank {
+			if len(a.out[i]) == 0 {
+				dangling += rank[i]
+			}
+		}
+		base := (1-cfg.Damping)/float64(n) + cfg.Damping*dangling/float64(n)
+		delta := 0.0
+		for j := range next {
+			sum := 0.0
+			for _, i := range a.in[j] {
+				sum += rank[i] / float64(len(a.out[i]))
+			}
+			next[j] = base + cfg.Damping*sum
+			delta += math.Abs(next[j] - rank[j])
+		}
+		rank, next = next, rank
+		if delta < cfg.Tolerance {
+			break
+		}
+	}
+	return scores(a.urls, rank)
+}
+
+// HITS computes the hub and authority scores of the pages of the graph, both normalized to unit length.
+// Good hubs link to many good authorities, good authorities are linked by many good hubs.
+func (g *Graph) HITS(cfg RankConfig) (hubs, authorities map[string]float64) {
+	cfg = cfg.withDefaults()
+	a := g.adjacency(cfg.IgnoreNofollow)
+	n := len(a.urls)
+	hub, auth := make([]float64, n), make([]float64, n)
+	for i := range hub {
+		hub[i] = 1
+	}
+	for iteration := 0; iteration < cfg.MaxIterations; iteration++ {
+		nextAuth, nextHub := make([]float64, n), make([]float64, n)
+		for j := range nextAuth {
+			for _, i := range a.in[j] {
+				nextAuth[j] += hub[i]
+			}
+		}
+		normalize(nextAuth)
+		for i := range nextHub {
+			for _, j := range a.out[i] {
+				nextHub[i] += nextAuth[j]
+			}
+		}
+		normalize(nextHub)
+		delta := 0.0
+		for i := range hub {
+			delta += math.Abs(nextHub[i]-hub[i]) + math.Abs(nextAuth[i]-auth[i])
+		}
+		hub, auth = nextHub, nextAuth
+		if delta < cfg.Tolerance {
+			break
+		}
+	}
+	return scores(a.urls, hub), scores(a.urls, auth)
+}
+
+// Ranker scores the urls by their PageRank during the crawl, eg. for best-first ordering of the frontier
+// with scraper.Scrapper.WithPriority. Scores are recomputed in the background once they are older than the interval,
+// so the score of a url lags behind the discovery of its links.
+type Ranker struct {
+	graph    *Graph
+	cfg      RankConfig
+	interval time.Duration
+
+	mu         sync.RWMutex // mutex protecting scores and computedAt
+	scores     map[string]float64
+	computedAt time.Time
+	computing  atomic.Bool
+}
+
+// NewRanker creates a ranker of the pages of the graph, recomputing the scores at most once per interval.
+func NewRanker(g *Graph, cfg RankConfig, interval time.Duration) *Ranker {
+	return &Ranker{graph: g, cfg: cfg, interval: interval, scores: map[string]float64{}}
+}
+
+// Priority returns the last computed PageRank of the url, 0 if the url wasn't known back then.
+func (r *Ranker) Priority(url string) float64 {
+	r.mu.RLock()
+	score, stale := r.scores[url], time.Since(r.computedAt) >= r.interval
+	r.mu.RUnlock()
+	if stale && r.computing.CompareAndSwap(false, true) {
+		go r.Update()
+	}
+	return score
+}
+
+// Update recomputes the scores right away.
+func (r *Ranker) Update() {
+	defer r.computing.Store(false)
+	scores := r.graph.PageRank(r.cfg)
+	r.mu.Lock()
+	r.scores, r.computedAt = scores, time.Now()
+	r.mu.Unlock()
+}
+
+// normalize scales the vector to unit length.
+func normalize(v []float64) {
+	norm := 0.0
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+func scores(urls []string, values []float64) map[string]float64 {
+	result := make(map[string]float64, len(urls))
+	for i, url := range urls {
+		result[url] = values[i]
+	}
+	return result
+}
+
+func hasRel(rels []string, rel string) bool {
+	for _, r := range rels {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
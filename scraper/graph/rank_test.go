@@ -0,0 +1,73 @@
+package graph
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+func TestPageRank(t *testing.T) {
+	g := newTestGraph()
+	ranks := g.PageRank(RankConfig{})
+
+	total := 0.0
+	for _, rank := range ranks {
+		total += rank
+	}
+	if math.Abs(total-1) > 1e-6 {
+		t.Fatalf("ranks sum up to %v", total)
+	}
+	// c is linked by a and b, while d isn't linked at all
+	if !(ranks["c"] > ranks["b"] && ranks["b"] > ranks["d"]) {
+		t.Fatalf("unexpected ranks %v", ranks)
+	}
+
+	// without the nofollow link of b, c loses rank
+	nofollow := g.PageRank(RankConfig{IgnoreNofollow: true})
+	if nofollow["c"] >= ranks["c"] {
+		t.Fatalf("nofollow link counted, %v >= %v", nofollow["c"], ranks["c"])
+	}
+
+	// dangling pages keep the ranks summing up to 1
+	g.AddLinks("a", []html.Link{{URL: "b"}, {URL: "c"}, {URL: "e"}})
+	total = 0
+	for _, rank := range g.PageRank(RankConfig{}) {
+		total += rank
+	}
+	if math.Abs(total-1) > 1e-6 {
+		t.Fatalf("ranks with dangling page sum up to %v", total)
+	}
+}
+
+func TestHITS(t *testing.T) {
+	g := New()
+	// h1 and h2 are hubs linking to the authorities a1 and a2
+	for _, hub := range []string{"h1", "h2"} {
+		g.AddLinks(hub, []html.Link{{URL: "a1"}, {URL: "a2"}})
+	}
+	g.AddLinks("a1", []html.Link{{URL: "a2"}})
+
+	hubs, authorities := g.HITS(RankConfig{})
+	if !(hubs["h1"] > hubs["a1"] && hubs["a1"] > hubs["a2"]) {
+		t.Fatalf("unexpected hubs %v", hubs)
+	}
+	if !(authorities["a2"] > authorities["a1"] && authorities["a1"] > authorities["h1"]) {
+		t.Fatalf("unexpected authorities %v", authorities)
+	}
+}
+
+func TestRanker(t *testing.T) {
+	g := newTestGraph()
+	ranker := NewRanker(g, RankConfig{}, time.Hour)
+	if priority := ranker.Priority("c"); priority != 0 {
+		t.Fatalf("unexpected priority before the computation %v", priority)
+	}
+	// the first call triggers the computation in the background
+	for deadline := time.Now().Add(time.Second); ranker.Priority("c") == 0 && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+	}
+	if ranker.Priority("c") <= ranker.Priority("d") {
+		t.Fatalf("unexpected priorities %v <= %v", ranker.Priority("c"), ranker.Priority("d"))
+	}
+}
@@ -0,0 +1,321 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+// ErrDuplicate is the error of jobs dropped because their url has already been scraped or is being scraped right now.
+var ErrDuplicate = errors.New("url already scraped")
+
+// JobStatus represents the stage of the scrape job lifecycle.
+type JobStatus int
+
+const (
+	JobQueued    JobStatus = iota // waiting for a worker
+	JobRunning                    // being scraped by a worker
+	JobRetrying                   // waiting for retry, because its fetch failed or the breaker of its host is open
+	JobDone                       // scraped and analyzed
+	JobFailed                     // scrape failed
+	JobDropped                    // dropped as a duplicate, out of the scope, as a crawler trap or because of the page directives
+	JobCancelled                  // cancelled before finishing
+)
+
+func (s JobStatus) String() string {
+	switch s {
+	case JobQueued:
+		return "QUEUED"
+	case JobRunning:
+		return "RUNNING"
+	case JobRetrying:
+		return "RETRYING"
+	case JobDone:
+		return "DONE"
+	case JobFailed:
+		return "FAILED"
+	case JobDropped:
+		return "DROPPED"
+	case JobCancelled:
+		return "CANCELLED"
+	}
+	panic("unknown status")
+}
+
+// Finished reports whether the status is final.
+func (s JobStatus) Finished() bool {
+	return s >= JobDone
+}
+
+// JobHandle represents a single scrape job submitted to the scrapper.
+// It allows to follow the job status, cancel it and wait for its result.
+type JobHandle struct {
+	id        uint64
+	url       string
+	createdAt time.Time
+	analyzer  analytics.Analyzer
+
+	// ctx of the job, cancelled either by Cancel, the submitter ctx or when the scrapper stops
+	ctx    context.Context
+	cancel func()
+
+	mu sync.Mutex // mutex protecting fields below
+	// stop the ctx callbacks once the job is finished
+	stopLink     func() bool
+	stopWithdraw func() bool
+	status       JobStatus
+	attempts     int
+	page         *Page
+	err          error
+
+	done    chan struct{} // closed once the job is finished
+	onDone  func(*JobHandle)
+	resolve sync.Once
+}
+
+// JobInfo is a point in time description of the job.
+type JobInfo struct {
+	ID        uint64
+	URL       string
+	Status    JobStatus
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// newJobHandle creates a job that is cancelled once either of ctx or stopped is done.
+func newJobHandle(ctx, stopped context.Context, id uint64, url string, analyzer analytics.Analyzer, onDone func(*JobHandle)) *JobHandle {
+	if analyzer == nil {
+		analyzer = nopAnalyzer{}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	h := &JobHandle{
+		id:        id,
+		url:       url,
+		createdAt: time.Now(),
+		analyzer:  analyzer,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		onDone:    onDone,
+	}
+	// callbacks may fire right away, so the fields are guarded
+	h.mu.Lock()
+	h.stopLink = context.AfterFunc(stopped, cancel)
+	h.stopWithdraw = context.AfterFunc(ctx, h.withdraw)
+	h.mu.Unlock()
+	return h
+}
+
+// ID returns the unique id of the job.
+func (h *JobHandle) ID() uint64 { return h.id }
+
+// URL returns the url scraped by the job.
+func (h *JobHandle) URL() string { return h.url }
+
+// Status returns the current status of the job.
+func (h *JobHandle) Status() JobStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status
+}
+
+// Page returns the scraped page. It is nil until the job is finished and when no response was received.
+// Failed jobs keep the page answered with a retryable status, see ErrRetryableStatus.
+func (h *JobHandle) Page() *Page {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.page
+}
+
+// Err returns the final error of the job. It is nil until the job is finished and when the job succeeded.
+func (h *JobHandle) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// Done returns a channel that is closed once the job is finished.
+func (h *JobHandle) Done() <-chan struct{} { return h.done }
+
+// Wait waits for the job to finish and returns its final error.
+// If ctx is done before that, the ctx error is returned instead. The job itself is not affected.
+func (h *JobHandle) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-h.done:
+		return h.Err()
+	}
+}
+
+// Cancel cancels the job. Queued jobs are withdrawn, while running jobs abort their scrape.
+// Cancelling a finished job has no effect.
+func (h *JobHandle) Cancel() {
+	h.cancel()
+}
+
+// withdraw finishes the cancelled job, unless it's running. Running jobs are finished by their worker.
+func (h *JobHandle) withdraw() {
+	h.mu.Lock()
+	running := h.status == JobRunning
+	h.mu.Unlock()
+	if !running {
+		h.finish(JobCancelled, nil, h.ctx.Err())
+	}
+}
+
+// Info returns the point in time description of the job.
+func (h *JobHandle) Info() JobInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return JobInfo{
+		ID:        h.id,
+		URL:       h.url,
+		Status:    h.status,
+		Attempts:  h.attempts,
+		CreatedAt: h.createdAt,
+	}
+}
+
+// result returns the result of the finished job.
+func (h *JobHandle) result() Result {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return Result{
+		JobID:    h.id,
+		URL:      h.url,
+		Page:     h.page,
+		Err:      h.err,
+		Attempt:  h.attempts,
+		Duration: time.Since(h.createdAt),
+	}
+}
+
+// start marks the job as running. Returns false if the job has already finished.
+func (h *JobHandle) start() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.status.Finished() {
+		return false
+	}
+	h.status = JobRunning
+	h.attempts++
+	return true
+}
+
+// retry marks the job as waiting for retry, unless it's already finished. Returns false if the job wasn't marked,
+// because it's finished or already waiting.
+func (h *JobHandle) retry() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.status.Finished() || h.status == JobRetrying {
+		return false
+	}
+	h.status = JobRetrying
+	return true
+}
+
+// finished reports whether the job is finished.
+func (h *JobHandle) finished() bool {
+	return h.Status().Finished()
+}
+
+// finish finishes the job exactly once, passing the page to the analyzer on success or cancelling it otherwise.
+func (h *JobHandle) finish(status JobStatus, page *Page, err error) {
+	h.resolve.Do(func() {
+		h.mu.Lock()
+		h.status = status
+		h.page = page
+		h.err = err
+		stopLink, stopWithdraw := h.stopLink, h.stopWithdraw
+		h.mu.Unlock()
+
+		if status == JobDone {
+			if analyzer, ok := h.analyzer.(PageAnalyzer); ok {
+				analyzer.AnalyzePage(page)
+			} else {
+				h.analyzer.Analyze(page.Body)
+			}
+		} else {
+			h.analyzer.Cancel(err)
+		}
+		stopLink()
+		stopWithdraw()
+		h.cancel()
+		if h.onDone != nil {
+			h.onDone(h)
+		}
+		close(h.done)
+	})
+}
+
+// fail finishes the job with the error, distinguishing cancelled jobs from failed ones. Page is kept if a response was received.
+func (h *JobHandle) fail(page *Page, err error) {
+	if h.ctx.Err() != nil {
+		h.finish(JobCancelled, nil, err)
+		return
+	}
+	h.finish(JobFailed, page, err)
+}
+
+// jobRegistry keeps track of unfinished jobs.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[uint64]*JobHandle
+	idle chan struct{} // closed while there are no unfinished jobs
+}
+
+func newJobRegistry() *jobRegistry {
+	idle := make(chan struct{})
+	close(idle)
+	return &jobRegistry{jobs: make(map[uint64]*JobHandle), idle: idle}
+}
+
+func (r *jobRegistry) add(h *JobHandle) {
+	r.mu.Lock()
+	if len(r.jobs) == 0 {
+		r.idle = make(chan struct{})
+	}
+	r.jobs[h.id] = h
+	r.mu.Unlock()
+}
+
+func (r *jobRegistry) remove(h *JobHandle) {
+	r.mu.Lock()
+	if _, ok := r.jobs[h.id]; ok {
+		delete(r.jobs, h.id)
+		if len(r.jobs) == 0 {
+			close(r.idle)
+		}
+	}
+	r.mu.Unlock()
+}
+
+func (r *jobRegistry) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.jobs)
+}
+
+// idleCh returns a channel that is closed once there are no unfinished jobs.
+func (r *jobRegistry) idleCh() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.idle
+}
+
+// list returns description of all unfinished jobs ordered by their id.
+func (r *jobRegistry) list() []JobInfo {
+	r.mu.Lock()
+	infos := make([]JobInfo, 0, len(r.jobs))
+	for _, h := range r.jobs {
+		infos = append(infos, h.Info())
+	}
+	r.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
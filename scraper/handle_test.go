@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestJobHandle checks the lifecycle of jobs observed through their handles.
+func TestJobHandle(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	running, err := scrapper.ScrapeContext(ctx, server.URL+"/running", &testingCallbackAnalyzer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued, err := scrapper.ScrapeContext(ctx, server.URL+"/queued", &testingCallbackAnalyzer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.ID() <= running.ID() {
+		t.Fatalf("unexpected job ids. got %v after %v", queued.ID(), running.ID())
+	}
+	for running.Status() != JobRunning {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	jobs := scrapper.Jobs()
+	if len(jobs) != 2 || jobs[0].ID != running.ID() || jobs[1].ID != queued.ID() {
+		t.Fatalf("unexpected jobs. got %+v", jobs)
+	}
+
+	// queued job is withdrawn right away
+	analyzer := queued.analyzer.(*testingCallbackAnalyzer)
+	queued.Cancel()
+	if err := queued.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error. got %v, want %v", err, context.Canceled)
+	}
+	if queued.Status() != JobCancelled || !errors.Is(analyzer.err, context.Canceled) {
+		t.Fatalf("job not cancelled. status %v, analyzer err %v", queued.Status(), analyzer.err)
+	}
+
+	close(release)
+	if err := running.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if running.Status() != JobDone {
+		t.Fatalf("unexpected status. got %v, want %v", running.Status(), JobDone)
+	}
+
+	// already scraped url is dropped
+	duplicate, err := scrapper.ScrapeContext(ctx, server.URL+"/running", &testingCallbackAnalyzer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := duplicate.Wait(ctx); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrDuplicate)
+	}
+	if duplicate.Status() != JobDropped {
+		t.Fatalf("unexpected status. got %v, want %v", duplicate.Status(), JobDropped)
+	}
+	if len(scrapper.Jobs()) != 0 {
+		t.Fatalf("finished jobs still listed. got %+v", scrapper.Jobs())
+	}
+}
+
+// TestJobHandleCancelRunning checks that cancelling a running job aborts its fetch.
+func TestJobHandleCancelRunning(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	handle, err := scrapper.ScrapeContext(ctx, server.URL, &testingCallbackAnalyzer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for handle.Status() != JobRunning {
+		time.Sleep(10 * time.Millisecond)
+	}
+	handle.Cancel()
+	if err := handle.Wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error. got %v, want %v", err, context.Canceled)
+	}
+	if handle.Status() != JobCancelled {
+		t.Fatalf("unexpected status. got %v, want %v", handle.Status(), JobCancelled)
+	}
+}
@@ -0,0 +1,204 @@
+package scraper
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/change"
+	"github.com/Exca-DK/webscraper/scraper/prims"
+)
+
+// Event describes a single step of the scrape job lifecycle.
+type Event struct {
+	JobID      uint64
+	URL        string
+	Session    string // name of the session of the job
+	Attempt    int    // how many times the job was started by a worker so far
+	Time       time.Time
+	Duration   time.Duration  // fetch duration for OnFetched, time since the submission for OnFailed, OnCancelled and OnDeduplicated
+	StatusCode int            // response status code for OnFetched
+	Err        error          // final error for OnFailed, OnCancelled and OnDeduplicated
+	Change     *change.Change // detected change of the content for OnChanged
+	Host       string         // host of the circuit breaker for OnBreakerChanged
+	Breaker    BreakerState   // new state of the circuit breaker for OnBreakerChanged
+}
+
+// Observer observes the lifecycle of scrape jobs.
+// Callbacks are called one at a time, in the order of events, from a goroutine separate from the scrapper,
+// so slow observers never block the scraping. Embed NopObserver to implement only some of the callbacks.
+type Observer interface {
+	OnQueued(Event)         // target accepted by the scrapper
+	OnDeduplicated(Event)   // target dropped, because its url is already seen or being scraped
+	OnFetchStart(Event)     // worker started fetching the target
+	OnFetched(Event)        // page fetched successfully
+	OnRetryScheduled(Event) // target waits for retry, because its fetch failed or the breaker of its host is open
+	OnFailed(Event)         // fetch failed
+	OnCancelled(Event)      // target cancelled, or dropped for other reason than being a duplicate
+	OnChanged(Event)        // content of the page changed since its previous scrape
+	OnBreakerChanged(Event) // circuit breaker of the host of the target changed its state
+}
+
+// NopObserver is an observer that ignores all events.
+type NopObserver struct{}
+
+func (NopObserver) OnQueued(Event)         {}
+func (NopObserver) OnDeduplicated(Event)   {}
+func (NopObserver) OnFetchStart(Event)     {}
+func (NopObserver) OnFetched(Event)        {}
+func (NopObserver) OnRetryScheduled(Event) {}
+func (NopObserver) OnFailed(Event)         {}
+func (NopObserver) OnCancelled(Event)      {}
+func (NopObserver) OnChanged(Event)        {}
+func (NopObserver) OnBreakerChanged(Event) {}
+
+// eventKind selects the observer callback of the event.
+type eventKind int
+
+const (
+	eventQueued eventKind = iota
+	eventDeduplicated
+	eventFetchStart
+	eventFetched
+	eventRetryScheduled
+	eventFailed
+	eventCancelled
+	eventChanged
+	eventBreakerChanged
+)
+
+// deliver calls the callback of the kind.
+func (k eventKind) deliver(o Observer, e Event) {
+	switch k {
+	case eventQueued:
+		o.OnQueued(e)
+	case eventDeduplicated:
+		o.OnDeduplicated(e)
+	case eventFetchStart:
+		o.OnFetchStart(e)
+	case eventFetched:
+		o.OnFetched(e)
+	case eventRetryScheduled:
+		o.OnRetryScheduled(e)
+	case eventFailed:
+		o.OnFailed(e)
+	case eventCancelled:
+		o.OnCancelled(e)
+	case eventChanged:
+		o.OnChanged(e)
+	case eventBreakerChanged:
+		o.OnBreakerChanged(e)
+	}
+}
+
+type queuedEvent struct {
+	kind  eventKind
+	event Event
+}
+
+// eventBus delivers events to the observers without blocking the publishers.
+// Events are buffered in an unbounded queue and delivered by a single goroutine, started with the first observer.
+type eventBus struct {
+	mu        sync.Mutex // mutex protecting fields below
+	observers []Observer
+	queue     prims.Queue[queuedEvent]
+	closed    bool // no more events will be emitted
+
+	wake chan struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		queue: make(prims.Queue[queuedEvent], 0),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// add registers the observer.
+func (b *eventBus) add(o Observer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.observers) == 0 {
+		go b.pump()
+	}
+	b.observers = append(b.observers, o)
+}
+
+// emit queues the event for delivery. Events are discarded if there are no observers or the bus is closed.
+func (b *eventBus) emit(kind eventKind, e Event) {
+	b.mu.Lock()
+	if len(b.observers) == 0 || b.closed {
+		b.mu.Unlock()
+		return
+	}
+	e.Time = time.Now()
+	b.queue.Push(queuedEvent{kind: kind, event: e})
+	b.mu.Unlock()
+	b.notify()
+}
+
+// close stops the delivery once all of the emitted events are delivered.
+func (b *eventBus) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *eventBus) notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump delivers queued events to the observers.
+func (b *eventBus) pump() {
+	for {
+		b.mu.Lock()
+		e, ok := b.queue.Pop()
+		observers, closed := b.observers, b.closed
+		b.mu.Unlock()
+
+		if ok {
+			for _, o := range observers {
+				e.kind.deliver(o, e.event)
+			}
+			continue
+		}
+		if closed {
+			return
+		}
+		<-b.wake
+	}
+}
+
+// newEvent creates the event of the target.
+func newEvent(target scrapeTarget) Event {
+	info := target.handle.Info()
+	return Event{
+		JobID:   info.ID,
+		URL:     info.URL,
+		Session: target.session.name,
+		Attempt: info.Attempts,
+	}
+}
+
+// finishedEvent returns the event of the finished job, or false if the job succeeded and is reported by OnFetched.
+func finishedEvent(target scrapeTarget) (eventKind, Event, bool) {
+	result := target.handle.result()
+	e := newEvent(target)
+	e.Duration, e.Err = result.Duration, result.Err
+	switch target.handle.Status() {
+	case JobFailed:
+		return eventFailed, e, true
+	case JobCancelled:
+		return eventCancelled, e, true
+	case JobDropped:
+		if errors.Is(result.Err, ErrDuplicate) {
+			return eventDeduplicated, e, true
+		}
+		return eventCancelled, e, true
+	}
+	return 0, e, false
+}
@@ -0,0 +1,154 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/change"
+)
+
+// recordingObserver records the names of the received events per url.
+type recordingObserver struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func (o *recordingObserver) record(name string, e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events[e.URL] = append(o.events[e.URL], name)
+}
+
+func (o *recordingObserver) OnQueued(e Event)         { o.record("queued", e) }
+func (o *recordingObserver) OnDeduplicated(e Event)   { o.record("deduplicated", e) }
+func (o *recordingObserver) OnFetchStart(e Event)     { o.record("start", e) }
+func (o *recordingObserver) OnFetched(e Event)        { o.record("fetched", e) }
+func (o *recordingObserver) OnRetryScheduled(e Event) { o.record("retry", e) }
+func (o *recordingObserver) OnFailed(e Event)         { o.record("failed", e) }
+func (o *recordingObserver) OnCancelled(e Event)      { o.record("cancelled", e) }
+func (o *recordingObserver) OnChanged(e Event)        { o.record("changed", e) }
+func (o *recordingObserver) OnBreakerChanged(e Event) { o.record("breaker", e) }
+
+// get returns the events of the url. Retries depend on the timing of the workers, so they are skipped.
+func (o *recordingObserver) get(url string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var events []string
+	for _, event := range o.events[url] {
+		if event != "retry" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// TestObserver checks that the observer receives the lifecycle events of the jobs.
+func TestObserver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	observer := &recordingObserver{events: make(map[string][]string)}
+	scrapper := NewScrapper(nil).WithThreads(2).WithObserver(observer)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	fetched, unreachable := server.URL+"/page", "http://127.0.0.1:0/page"
+	for _, url := range []string{fetched, fetched, unreachable} {
+		handle, err := scrapper.ScrapeContext(ctx, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle.Wait(ctx)
+	}
+	scrapper.Drain(ctx)
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{url: fetched, want: []string{"queued", "start", "fetched", "queued", "deduplicated"}},
+		{url: unreachable, want: []string{"queued", "start", "failed"}},
+	}
+	for _, test := range tests {
+		var got []string
+		// delivered asynchronously
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if got = observer.get(test.url); len(got) == len(test.want) {
+				break
+			}
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("unexpected events of %v. got %v, want %v", test.url, got, test.want)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf("unexpected events of %v. got %v, want %v", test.url, got, test.want)
+			}
+		}
+	}
+}
+
+// changeObserver collects the detected changes.
+type changeObserver struct {
+	NopObserver
+	changes chan Event
+}
+
+func (o *changeObserver) OnChanged(e Event) { o.changes <- e }
+
+// TestChangeDetection checks that the changes of the page between its scrapes are reported with the diff.
+func TestChangeDetection(t *testing.T) {
+	var mu sync.Mutex
+	price := "10 €"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write([]byte(`<html><body><p>` + time.Now().String() + `</p><span class="price">` + price + `</span></body></html>`))
+	}))
+	defer server.Close()
+
+	detector, err := change.NewDetector(".price")
+	if err != nil {
+		t.Fatal(err)
+	}
+	observer := &changeObserver{changes: make(chan Event, 10)}
+	scrapper := NewScrapper(nil).WithThreads(2).WithChangeDetector(detector).WithObserver(observer)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, p := range []string{"10 €", "10 €", "12 €"} {
+		mu.Lock()
+		price = p
+		mu.Unlock()
+		handles, err := scrapper.Rescrape(ctx, []string{server.URL}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles[0].Wait(ctx)
+		if handles[0].Status() != JobDone {
+			t.Fatalf("unexpected status %v", handles[0].Status())
+		}
+	}
+
+	select {
+	case e := <-observer.changes:
+		if e.URL != server.URL || e.Change.Diff.String() != "- 10 €\n+ 12 €" {
+			t.Fatalf("unexpected change %+v", e.Change)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("change not reported")
+	}
+	select {
+	case e := <-observer.changes:
+		t.Fatalf("unexpected change %+v", e.Change)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
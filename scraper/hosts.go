@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"net/url"
+	"sync"
+)
+
+// HostOf returns the host of the url, or empty string if the url can't be parsed.
+func HostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// hostLimiter limits the amount of concurrent scrapes per host.
+type hostLimiter struct {
+	mu       sync.Mutex
+	limit    int            // default limit of hosts, 0 means unlimited
+	limits   map[string]int // hosts with limit different from the default one
+	inFlight map[string]int
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit:    limit,
+		limits:   make(map[string]int),
+		inFlight: make(map[string]int),
+	}
+}
+
+// acquire reserves a scrape slot for the host. Returns false if the host is at its limit.
+func (h *hostLimiter) acquire(host string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	limit := h.limitOf(host)
+	if limit != 0 && h.inFlight[host] >= limit {
+		return false
+	}
+	h.inFlight[host]++
+	return true
+}
+
+// release frees the scrape slot of the host.
+func (h *hostLimiter) release(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.inFlight[host]--
+	if h.inFlight[host] <= 0 {
+		delete(h.inFlight, host)
+	}
+}
+
+// setLimit changes the limit of the host.
+func (h *hostLimiter) setLimit(host string, limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limits[host] = limit
+}
+
+// limitOf returns the limit of the host. Must be called with mu held.
+func (h *hostLimiter) limitOf(host string) int {
+	if limit, ok := h.limits[host]; ok {
+		return limit
+	}
+	return h.limit
+}
+
+// capLimit lowers the default limit of hosts to limit, unless it's already lower.
+func (h *hostLimiter) capLimit(limit int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.limit == 0 || h.limit > limit {
+		h.limit = limit
+	}
+}
+
+// getLimit returns the limit of the host.
+func (h *hostLimiter) getLimit(host string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.limitOf(host)
+}
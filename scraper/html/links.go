@@ -0,0 +1,93 @@
+package html
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link is an anchor of an HTML page.
+type Link struct {
+	URL  string   // absolute url of the link, without the fragment
+	Text string   // whitespace normalized anchor text
+	Rel  []string // lowercased values of the rel attribute, eg. nofollow
+}
+
+// HasRel reports whether the link has the rel value.
+func (l Link) HasRel(rel string) bool {
+	return contains(l.Rel, rel)
+}
+
+// ExtractLinks parses an HTML page and returns its http and https anchors in the document order.
+// Relative urls are resolved against the base url of the page, or the <base> element if the page has one.
+// Unlike ExtractUrlsFromPage, the links aren't checked for being resolvable, so that broken ones are kept as well.
+func ExtractLinks(page string, base string) ([]Link, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	reader := getReader(page)
+	defer freeReader(reader)
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Link
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "base":
+				if href, ok := lookupAttr(n, "href"); ok {
+					if resolved, err := baseURL.Parse(strings.TrimSpace(href)); err == nil {
+						baseURL = resolved
+					}
+				}
+			case "a":
+				if href, ok := lookupAttr(n, "href"); ok {
+					if link, ok := resolveLink(baseURL, href); ok {
+						links = append(links, Link{
+							URL:  link,
+							Text: strings.Join(strings.Fields(textOf(n)), " "),
+							Rel:  strings.Fields(strings.ToLower(attr(n, "rel"))),
+						})
+					}
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return links, nil
+}
+
+// resolveLink resolves the href against the base url. Returns false for links other than http and https.
+func resolveLink(base *url.URL, href string) (string, bool) {
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.String(), true
+}
+
+// textOf returns the concatenated text of the node and its descendants.
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return b.String()
+}
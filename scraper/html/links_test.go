@@ -0,0 +1,65 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	page := `
+		<html><body>
+			<a href="/about">About   <b>us</b></a>
+			<a href="https://other.com/page#top" rel="NoFollow external">Other</a>
+			<a href="mailto:info@example.com">Mail</a>
+			<a href="contact?x=1">Contact</a>
+			<a name="anchor">No href</a>
+		</body></html>`
+
+	links, err := ExtractLinks(page, "https://example.com/docs/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		{URL: "https://example.com/about", Text: "About us"},
+		{URL: "https://other.com/page", Text: "Other", Rel: []string{"nofollow", "external"}},
+		{URL: "https://example.com/docs/contact?x=1", Text: "Contact"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("unexpected links %+v", links)
+	}
+	for i := range want {
+		if links[i].URL != want[i].URL || links[i].Text != want[i].Text || strings.Join(links[i].Rel, ",") != strings.Join(want[i].Rel, ",") {
+			t.Fatalf("unexpected link %+v, want %+v", links[i], want[i])
+		}
+	}
+	if !links[1].HasRel("nofollow") || links[0].HasRel("nofollow") {
+		t.Fatal("unexpected rel")
+	}
+
+	// base element changes the resolution of relative links
+	links, err = ExtractLinks(`<head><base href="https://cdn.example.com/v2/"></head><a href="page">x</a>`, "https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].URL != "https://cdn.example.com/v2/page" {
+		t.Fatalf("unexpected links %+v", links)
+	}
+}
+
+func TestExtractMeta(t *testing.T) {
+	page := `
+		<html><head>
+			<META name="Robots" content="NoIndex, nofollow">
+			<link rel="canonical" href=" https://example.com/ ">
+			<link rel="alternate" href="https://example.com/en">
+		</head><body>
+			<meta name="robots" content="none">
+		</body></html>`
+	meta := ExtractMeta(page)
+	if strings.Join(meta.Robots, ",") != "noindex,nofollow" || meta.Canonical != "https://example.com/" {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+	if meta := ExtractMeta(`<p>no head</p>`); len(meta.Robots) != 0 || meta.Canonical != "" {
+		t.Fatalf("unexpected meta %+v", meta)
+	}
+}
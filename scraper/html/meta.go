@@ -0,0 +1,56 @@
+package html
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Meta is the metadata of an HTML page directed at crawlers.
+type Meta struct {
+	Robots    []string // lowercased directives of <meta name="robots">, eg. noindex
+	Canonical string   // href of <link rel="canonical">, as written in the page
+}
+
+// ExtractMeta parses the head of an HTML page and returns its metadata directed at crawlers.
+// Parsing stops at the body of the page.
+func ExtractMeta(page string) Meta {
+	reader := getReader(page)
+	defer freeReader(reader)
+	tokenizer := html.NewTokenizer(reader)
+	var meta Meta
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				return meta
+			case "meta":
+				if strings.EqualFold(tokenAttr(token, "name"), "robots") {
+					for _, directive := range strings.Split(strings.ToLower(tokenAttr(token, "content")), ",") {
+						if directive = strings.TrimSpace(directive); directive != "" {
+							meta.Robots = append(meta.Robots, directive)
+						}
+					}
+				}
+			case "link":
+				if meta.Canonical == "" && contains(strings.Fields(strings.ToLower(tokenAttr(token, "rel"))), "canonical") {
+					meta.Canonical = strings.TrimSpace(tokenAttr(token, "href"))
+				}
+			}
+		}
+	}
+}
+
+// tokenAttr returns the value of the attribute of the token, or empty string if it's missing.
+func tokenAttr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
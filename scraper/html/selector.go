@@ -0,0 +1,210 @@
+package html
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Selector matches elements of an HTML document. It supports a subset of CSS selectors:
+// type, #id, .class, [attr] and [attr=value] simple selectors, their compounds like "div.price[data-id]",
+// descendant combinator "div .price" and lists of selectors "h1, .title".
+type Selector struct {
+	alternatives [][]compound // each alternative is a chain of descendant compounds
+}
+
+// compound is a sequence of simple selectors that all have to match the same element.
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	key, value string
+	hasValue   bool
+}
+
+// ParseSelector parses the CSS selector.
+func ParseSelector(selector string) (*Selector, error) {
+	s := &Selector{}
+	for _, alternative := range strings.Split(selector, ",") {
+		parts := strings.Fields(alternative)
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("invalid selector %q: empty selector", selector)
+		}
+		chain := make([]compound, 0, len(parts))
+		for _, part := range parts {
+			c, err := parseCompound(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+			}
+			chain = append(chain, c)
+		}
+		s.alternatives = append(s.alternatives, chain)
+	}
+	return s, nil
+}
+
+// parseCompound parses compound selector like "div#main.article[lang=en]".
+func parseCompound(part string) (compound, error) {
+	var c compound
+	i := strings.IndexAny(part, "#.[")
+	if i < 0 {
+		i = len(part)
+	}
+	c.tag = strings.ToLower(part[:i])
+	if c.tag == "*" {
+		c.tag = ""
+	}
+	if strings.IndexFunc(c.tag, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' }) >= 0 {
+		return c, fmt.Errorf("unsupported type %q", c.tag)
+	}
+	for rest := part[i:]; len(rest) > 0; {
+		switch rest[0] {
+		case '#', '.':
+			end := strings.IndexAny(rest[1:], "#.[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			name := rest[1:end]
+			if name == "" {
+				return c, fmt.Errorf("empty name in %q", part)
+			}
+			if rest[0] == '#' {
+				c.id = name
+			} else {
+				c.classes = append(c.classes, name)
+			}
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return c, fmt.Errorf("unterminated attribute in %q", part)
+			}
+			attr := attrSelector{key: rest[1:end]}
+			if key, value, ok := strings.Cut(attr.key, "="); ok {
+				attr.key, attr.value, attr.hasValue = key, strings.Trim(value, `"'`), true
+			}
+			if attr.key == "" {
+				return c, fmt.Errorf("empty attribute in %q", part)
+			}
+			c.attrs = append(c.attrs, attr)
+			rest = rest[end+1:]
+		default:
+			return c, fmt.Errorf("unexpected %q in %q", rest[0], part)
+		}
+	}
+	return c, nil
+}
+
+// matches reports whether the element matches the compound.
+func (c compound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		classes := strings.Fields(attr(n, "class"))
+		for _, class := range c.classes {
+			if !contains(classes, class) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		value, ok := lookupAttr(n, a.key)
+		if !ok || (a.hasValue && value != a.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether the element matches the selector.
+func (s *Selector) Matches(n *html.Node) bool {
+	for _, chain := range s.alternatives {
+		if matchesChain(n, chain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesChain reports whether the element matches the last compound and its ancestors match the preceding ones.
+func matchesChain(n *html.Node, chain []compound) bool {
+	last := len(chain) - 1
+	if !chain[last].matches(n) {
+		return false
+	}
+	for i, ancestor := last-1, n.Parent; i >= 0; ancestor = ancestor.Parent {
+		if ancestor == nil {
+			return false
+		}
+		if chain[i].matches(ancestor) {
+			i--
+		}
+	}
+	return true
+}
+
+// ExtractText parses an HTML page and returns the text blocks of the elements matching the selector,
+// in the document order and without scripts and styles. Nil selector selects the whole page.
+func ExtractText(page string, selector *Selector) ([]string, error) {
+	reader := getReader(page)
+	defer freeReader(reader)
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, err
+	}
+	var texts []string
+	var walk func(n *html.Node, selected bool)
+	walk = func(n *html.Node, selected bool) {
+		if n.Type == html.ElementNode && (n.Data == script || n.Data == css) {
+			return
+		}
+		selected = selected || selector == nil || selector.Matches(n)
+		if selected && n.Type == html.TextNode {
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, selected)
+		}
+	}
+	walk(doc, false)
+	return texts, nil
+}
+
+// attr returns the value of the attribute of the element, or empty string if it's missing.
+func attr(n *html.Node, key string) string {
+	value, _ := lookupAttr(n, key)
+	return value
+}
+
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
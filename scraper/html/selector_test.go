@@ -0,0 +1,56 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractText(t *testing.T) {
+	page := `
+		<html>
+		<head><title>Shop</title><style>.price { color: red }</style></head>
+		<body>
+			<h1 class="title main">Product</h1>
+			<div id="offer" data-currency="eur">
+				<span class="price">10 &euro;</span>
+				<script>var price = 10;</script>
+				<p>Free    shipping</p>
+			</div>
+			<span class="price">unrelated</span>
+		</body>
+		</html>`
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{selector: "", want: []string{"Shop", "Product", "10 €", "Free shipping", "unrelated"}},
+		{selector: "#offer .price", want: []string{"10 €"}},
+		{selector: "span.price", want: []string{"10 €", "unrelated"}},
+		{selector: "div[data-currency=eur] p", want: []string{"Free shipping"}},
+		{selector: "h1.title.main, #offer p", want: []string{"Product", "Free shipping"}},
+		{selector: "table", want: nil},
+	}
+	for _, test := range tests {
+		var selector *Selector
+		if test.selector != "" {
+			var err error
+			if selector, err = ParseSelector(test.selector); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := ExtractText(page, selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Fatalf("unexpected text of %q. got %q, want %q", test.selector, got, test.want)
+		}
+	}
+
+	for _, selector := range []string{"", "div,", "a[href", "#", "div..x", "body > p"} {
+		if _, err := ParseSelector(selector); err == nil {
+			t.Fatalf("parsed invalid selector %q", selector)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package scraper
 
 import (
 	"context"
+	"time"
+
+	"github.com/Exca-DK/webscraper/workers"
 )
 
 // job represents a web scraping task with a target and a callback function.
@@ -13,20 +16,112 @@ type job struct {
 }
 
 // taskLoop is responsible for managing web scraping tasks within a worker thread.
-// It continuously waits for and processes scraping jobs by fetching and analyzing web pages.
+// It continuously waits for and processes scraping jobs by fetching and analyzing web pages,
+// until the scrapper stops or the pool asks the worker to retire.
 func (s *Scrapper) taskLoop(ctx context.Context, id string) error {
-	defer s.wg.Done()
+	retiring := workers.Retiring(ctx)
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
+		case <-retiring:
+			s.logger.Debug("retiring worker", "worker:", id)
+			return nil
 		case j := <-s.jobCh:
-			currentIndex := s.jobIndex.Add(1) - 1
-			err := s.scrape(ctx, currentIndex, j.target)
+			// handed over, free its place in the backlog and let the eventLoop send the next job
+			s.backlog.release(1)
+			s.release()
+			handle := j.target.handle
+			// withdrawn in the meantime
+			if !handle.start() {
+				j.callback()
+				continue
+			}
+			s.events.emit(eventFetchStart, newEvent(j.target))
+			ts := time.Now()
+			page, err := s.scrape(handle.ctx, handle.id, j.target)
+			err = fetchFailure(page, err)
+			s.observe(j.target, time.Since(ts), page, err)
 			if err != nil {
-				s.logger.Warn("failed fetching page", "worker:", id, "jobIndex:", currentIndex, "url:", j.target.url, "err:", err.Error())
+				s.logger.Warn("failed fetching page", "worker:", id, "jobIndex:", handle.id, "url:", j.target.url, "err:", err.Error())
+				// attempts left, fetch again once the worker is released
+				if handle.ctx.Err() == nil && handle.Info().Attempts < s.maxAttempts {
+					handle.retry()
+					j.callback()
+					s.refetch(j.target)
+					continue
+				}
 			}
+			// cancelled by Stop mid-fetch, kept for the final checkpoint
+			if err != nil && s.ctx.Err() != nil {
+				s.interrupt(j.target)
+			}
+			// release the target before finishing, so that it can be submitted again right away
 			j.callback()
+			if err != nil {
+				handle.fail(page, err)
+				continue
+			}
+			event := newEvent(j.target)
+			event.Duration, event.StatusCode = page.Duration, page.StatusCode
+			s.events.emit(eventFetched, event)
+			// fetched, but not to be analyzed
+			if err := s.applyRobots(j.target, page); err != nil {
+				handle.finish(JobDropped, page, err)
+				continue
+			}
+			if err := s.dedupContent(j.target, page); err != nil {
+				handle.finish(JobDropped, page, err)
+				continue
+			}
+			if err := s.detectNearDuplicate(j.target, page); err != nil {
+				handle.finish(JobDropped, page, err)
+				continue
+			}
+			s.detectChange(j.target, page)
+			handle.finish(JobDone, page, nil)
 		}
 	}
 }
+
+// observe passes the outcome of the fetch to the budget tracker and refresher of the session, the circuit breaker of the host
+// and the adaptive controller. Page is nil unless a response was received, err is the failure classified by fetchFailure.
+// Cancelled fetches are ignored.
+func (s *Scrapper) observe(target scrapeTarget, latency time.Duration, page *Page, err error) {
+	if target.handle.ctx.Err() != nil {
+		return
+	}
+	host := HostOf(target.url)
+	target.session.budget.record(host, page, err)
+	if target.session.refresh != nil && err == nil {
+		target.session.refresh.observe(target.url, page.Body)
+	}
+	statusCode := 0
+	if page != nil {
+		statusCode = page.StatusCode
+	}
+	s.recordHost(target, host, err)
+	if s.adaptive == nil {
+		return
+	}
+	s.adaptive.observe(host, latency, statusCode, err)
+}
+
+// detectChange passes the fetched page to the change detector and emits the detected change.
+func (s *Scrapper) detectChange(target scrapeTarget, page *Page) {
+	if s.changes == nil {
+		return
+	}
+	c, err := s.changes.Observe(target.url, page.Body)
+	if err != nil {
+		s.logger.Warn("failed detecting change", "url:", target.url, "err:", err.Error())
+		return
+	}
+	if c == nil {
+		return
+	}
+	s.logger.Info("page changed", "url:", target.url, "diff:", c.Diff.String())
+	event := newEvent(target)
+	event.Change = c
+	s.events.emit(eventChanged, event)
+}
@@ -0,0 +1,282 @@
+package linkcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper"
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+// Config configures the link checker.
+type Config struct {
+	Scope       func(url string) bool // pages crawled for links, the rest is only checked. Defaults to the hosts of the seeds
+	Concurrency int                   // maximum amount of concurrent visits, crawls and checks of the links, 8 if zero
+	Client      *http.Client          // client of the checks, with 10 seconds timeout if nil
+}
+
+// BrokenLink is a link that failed or responded with an error status.
+type BrokenLink struct {
+	URL        string   `json:"url"`
+	StatusCode int      `json:"status,omitempty"`
+	Err        string   `json:"error,omitempty"`
+	Referrers  []string `json:"referrers"` // sorted pages linking to the url, empty for the seeds
+}
+
+// Report is the result of the link check.
+type Report struct {
+	Pages   int          `json:"pages"`   // crawled pages within the scope
+	Checked int          `json:"checked"` // checked links, including the crawled pages
+	Broken  []BrokenLink `json:"broken"`  // broken links, sorted by url
+}
+
+// checker crawls the pages within the scope and checks every link found on them, including the ones outside of the scope.
+// Pages within the scope are fetched by the scrapper, other links are checked with HEAD, falling back to GET
+// for the servers that don't support it. Links wait in a queue for one of the limited visitors.
+type checker struct {
+	session  *scraper.Session
+	scope    func(url string) bool
+	client   *http.Client
+	visitors int // maximum amount of concurrent visits
+
+	wg        sync.WaitGroup // running visitors
+	mu        sync.Mutex     // mutex protecting fields below
+	queue     []string       // links waiting for their visit
+	running   int            // running visitors
+	referrers map[string]map[string]struct{}
+	broken    map[string]BrokenLink
+	pages     int
+	checked   int
+}
+
+// Check crawls the seeds within the scope using a new session of the scrapper and reports the broken links.
+func Check(ctx context.Context, s *scraper.Scrapper, seeds []string, cfg Config) (Report, error) {
+	if cfg.Scope == nil {
+		cfg.Scope = hostScope(seeds)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 8
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	c := &checker{
+		session:   s.NewSession(scraper.SessionConfig{Name: "check-links", Scope: cfg.Scope}),
+		scope:     cfg.Scope,
+		client:    cfg.Client,
+		visitors:  cfg.Concurrency,
+		referrers: make(map[string]map[string]struct{}),
+		broken:    make(map[string]BrokenLink),
+	}
+	defer c.session.Close()
+
+	for _, seed := range seeds {
+		c.visit(ctx, "", seed)
+	}
+	c.wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return Report{}, err
+	}
+	return c.report(), nil
+}
+
+// visit records the link from the referrer and queues its crawl or check, unless the link is already known.
+func (c *checker) visit(ctx context.Context, referrer, link string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	referrers, known := c.referrers[link]
+	if !known {
+		referrers = make(map[string]struct{})
+		c.referrers[link] = referrers
+	}
+	if referrer != "" {
+		referrers[referrer] = struct{}{}
+	}
+	if known {
+		return
+	}
+	c.queue = append(c.queue, link)
+	if c.running < c.visitors {
+		c.running++
+		c.wg.Add(1)
+		go c.work(ctx)
+	}
+}
+
+// work crawls or checks the queued links until the queue is empty or ctx is done.
+func (c *checker) work(ctx context.Context) {
+	defer c.wg.Done()
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 || ctx.Err() != nil {
+			c.running--
+			c.mu.Unlock()
+			return
+		}
+		link := c.queue[0]
+		c.queue = c.queue[1:]
+		c.mu.Unlock()
+
+		if c.scope(link) {
+			c.crawl(ctx, link)
+		} else {
+			c.check(ctx, link)
+		}
+	}
+}
+
+// crawl scrapes the page within the scope and visits its links.
+func (c *checker) crawl(ctx context.Context, link string) {
+	handle, err := c.session.ScrapeContext(ctx, link, nil)
+	if err != nil {
+		c.record(link, 0, err)
+		return
+	}
+	handle.Wait(ctx)
+	page := handle.Page()
+	if page == nil {
+		// left out by the scrapper, it isn't known to be broken
+		if dropped(handle.Err()) {
+			return
+		}
+		c.record(link, 0, handle.Err())
+		return
+	}
+	c.record(link, page.StatusCode, nil)
+	c.mu.Lock()
+	c.pages++
+	c.mu.Unlock()
+	if page.StatusCode >= http.StatusBadRequest || !isHTML(page.Header) {
+		return
+	}
+	links, err := html.ExtractLinks(page.Body, link)
+	if err != nil {
+		return
+	}
+	for _, l := range links {
+		c.visit(ctx, link, l.URL)
+	}
+}
+
+// check checks the link outside of the scope.
+func (c *checker) check(ctx context.Context, link string) {
+	status, err := c.request(ctx, http.MethodHead, link)
+	// some servers don't support HEAD, or respond to it differently
+	if err != nil || status >= http.StatusBadRequest {
+		status, err = c.request(ctx, http.MethodGet, link)
+	}
+	c.record(link, status, err)
+}
+
+// request sends the request and returns the status of the response. Body of the response is discarded.
+func (c *checker) request(ctx context.Context, method, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, nil
+}
+
+// record records the outcome of the check of the link.
+func (c *checker) record(link string, status int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked++
+	if err == nil && status < http.StatusBadRequest {
+		return
+	}
+	broken := BrokenLink{URL: link, StatusCode: status}
+	if err != nil {
+		broken.Err = err.Error()
+	}
+	c.broken[link] = broken
+}
+
+// report returns the report of the finished check.
+func (c *checker) report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	report := Report{Pages: c.pages, Checked: c.checked, Broken: make([]BrokenLink, 0, len(c.broken))}
+	for link, broken := range c.broken {
+		broken.Referrers = make([]string, 0, len(c.referrers[link]))
+		for referrer := range c.referrers[link] {
+			broken.Referrers = append(broken.Referrers, referrer)
+		}
+		sort.Strings(broken.Referrers)
+		report.Broken = append(report.Broken, broken)
+	}
+	sort.Slice(report.Broken, func(i, j int) bool { return report.Broken[i].URL < report.Broken[j].URL })
+	return report
+}
+
+// Write writes the report in the format, either text or json.
+func (r Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case "text":
+		var b strings.Builder
+		fmt.Fprintf(&b, "crawled %d pages, checked %d links, %d broken\n", r.Pages, r.Checked, len(r.Broken))
+		for _, broken := range r.Broken {
+			b.WriteString(broken.URL)
+			if broken.StatusCode != 0 {
+				fmt.Fprintf(&b, "\tstatus: %d", broken.StatusCode)
+			}
+			if broken.Err != "" {
+				fmt.Fprintf(&b, "\terr: %s", broken.Err)
+			}
+			b.WriteByte('\n')
+			for _, referrer := range broken.Referrers {
+				fmt.Fprintf(&b, "\treferred by %s\n", referrer)
+			}
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// hostScope returns scope accepting the urls of the hosts of the seeds.
+func hostScope(seeds []string) func(string) bool {
+	hosts := make(map[string]struct{}, len(seeds))
+	for _, seed := range seeds {
+		hosts[scraper.HostOf(seed)] = struct{}{}
+	}
+	return func(link string) bool {
+		_, ok := hosts[scraper.HostOf(link)]
+		return ok
+	}
+}
+
+// dropped reports whether the scrapper left the page out, eg. as a duplicate, a crawler trap or beyond the budget,
+// instead of failing to fetch it.
+func dropped(err error) bool {
+	for _, target := range []error{scraper.ErrDuplicate, scraper.ErrTrap, scraper.ErrBudgetExceeded, scraper.ErrNoindex, scraper.ErrOutOfScope} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTML reports whether the response is an HTML page. Responses without the content type are assumed to be.
+func isHTML(header http.Header) bool {
+	contentType := header.Get("Content-Type")
+	return contentType == "" || strings.Contains(contentType, "html")
+}
@@ -0,0 +1,106 @@
+package linkcheck
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/log"
+	"github.com/Exca-DK/webscraper/scraper"
+)
+
+func TestCheck(t *testing.T) {
+	// external site that rejects HEAD requests
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer external.Close()
+	dead := "http://127.0.0.1:1/gone"
+
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<a href="/a">a</a><a href="/missing">missing</a><a href="`+external.URL+`/ok">external</a><a href="`+dead+`">dead</a>`)
+		case "/a":
+			io.WriteString(w, `<a href="/">home</a><a href="/missing#top">missing</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	scrapper := scraper.NewScrapper(log.NewLogger(log.Warn, io.Discard)).WithThreads(4)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report, err := Check(ctx, scrapper, []string{site.URL + "/"}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pages != 3 || report.Checked != 5 || len(report.Broken) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	dl, missing := report.Broken[0], report.Broken[1]
+	if dl.URL != dead || dl.Err == "" || strings.Join(dl.Referrers, ",") != site.URL+"/" {
+		t.Fatalf("unexpected broken link %+v", dl)
+	}
+	if missing.URL != site.URL+"/missing" || missing.StatusCode != http.StatusNotFound || strings.Join(missing.Referrers, ",") != site.URL+"/,"+site.URL+"/a" {
+		t.Fatalf("unexpected broken link %+v", missing)
+	}
+
+	var text strings.Builder
+	if err := report.Write(&text, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "2 broken") || !strings.Contains(text.String(), "status: 404") {
+		t.Fatalf("unexpected text report %v", text.String())
+	}
+	var js strings.Builder
+	if err := report.Write(&js, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal([]byte(js.String()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Broken) != 2 || decoded.Broken[1].StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected json report %v", js.String())
+	}
+}
+
+func TestCheckDropped(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			io.WriteString(w, `<a href="/page?id=1">1</a><a href="/page?id=2">2</a><a href="/page?id=3">3</a>`)
+		case "/page":
+			io.WriteString(w, `<a href="/">home</a>`)
+		}
+	}))
+	defer site.Close()
+
+	// pages dropped as a crawler trap aren't broken
+	scrapper := scraper.NewScrapper(log.NewLogger(log.Warn, io.Discard)).WithThreads(4).WithTrapDetection(scraper.TrapConfig{MaxFamilyPages: 1})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	report, err := Check(ctx, scrapper, []string{site.URL + "/"}, Config{Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Pages != 2 || len(report.Broken) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,75 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Exca-DK/webscraper/scraper/html"
+	"github.com/Exca-DK/webscraper/scraper/simhash"
+)
+
+// ErrNearDuplicate is the error of jobs whose page near-duplicates a page already scraped through another url.
+var ErrNearDuplicate = fmt.Errorf("%w of a page with another url", ErrDuplicate)
+
+// NearDuplicateConfig configures the detection of near-duplicate pages, eg. mirrors or printer-friendly variants.
+type NearDuplicateConfig struct {
+	Threshold int  // maximum Hamming distance of the SimHash fingerprints of the texts of near-duplicate pages
+	Skip      bool // near-duplicate pages are dropped, so that they aren't analyzed and their links aren't followed
+}
+
+// DefaultNearDuplicateThreshold is the Hamming distance threshold used by the cli.
+const DefaultNearDuplicateThreshold = 3
+
+// NearDuplicate links the page to the page it near-duplicates.
+type NearDuplicate struct {
+	URL      string // url of the page seen first
+	Distance int    // Hamming distance of the fingerprints of the pages
+}
+
+// WithNearDuplicates enables the detection of near-duplicate pages. Detected pages have Page.NearDuplicate set
+// and are dropped with ErrNearDuplicate if cfg.Skip is set. Detection is disabled by default.
+// Pages are compared only with the pages of the same session.
+func (s *Scrapper) WithNearDuplicates(cfg NearDuplicateConfig) *Scrapper {
+	s.nearDuplicates = &cfg
+	return s
+}
+
+// detectNearDuplicate fingerprints the text of the page and returns the error the job should be dropped with, if any.
+// Pages without text are ignored.
+func (s *Scrapper) detectNearDuplicate(target scrapeTarget, page *Page) error {
+	if s.nearDuplicates == nil {
+		return nil
+	}
+	text, err := html.ExtractText(page.Body, nil)
+	if err != nil {
+		s.logger.Warn("failed fingerprinting page", "url:", target.url, "err:", err.Error())
+		return nil
+	}
+	page.Fingerprint = simhash.Fingerprint(strings.Join(text, " "))
+	if page.Fingerprint == 0 {
+		return nil
+	}
+	match, ok := target.session.fingerprints.observe(s.nearDuplicates.Threshold, target.url, page.Fingerprint)
+	if !ok {
+		return nil
+	}
+	page.NearDuplicate = &NearDuplicate{URL: match.URL, Distance: match.Distance}
+	s.logger.Debug("detected near duplicate", "url:", target.url, "of:", match.URL, "distance:", match.Distance)
+	if s.nearDuplicates.Skip {
+		return ErrNearDuplicate
+	}
+	return nil
+}
+
+// fingerprints is the SimHash index of the pages scraped by a session, created with the first fingerprinted page.
+type fingerprints struct {
+	once  sync.Once
+	index *simhash.Index
+}
+
+// observe adds the fingerprint of the url to the index and returns the nearest page within the threshold, if any.
+func (f *fingerprints) observe(threshold int, url string, fingerprint uint64) (simhash.Match, bool) {
+	f.once.Do(func() { f.index = simhash.NewIndex(threshold) })
+	return f.index.Observe(url, fingerprint)
+}
@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNearDuplicates(t *testing.T) {
+	const article = `<p>The quick brown fox jumps over the lazy dog while the farmer watches from the porch.
+		Later that evening the fox returns to the barn looking for chickens, but the dog is awake and barks loudly.
+		The farmer grabs a lantern and walks outside to see what caused all the noise in the middle of the night.</p>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article":
+			io.WriteString(w, `<html><body><nav>Home</nav>`+article+`</body></html>`)
+		case "/article/print":
+			io.WriteString(w, `<html><body><h1>Home</h1>`+article+`<script>print()</script></body></html>`)
+		case "/other":
+			io.WriteString(w, `<p>Stock markets closed higher on Friday as investors weighed the latest inflation figures.</p>`)
+		}
+	}))
+	defer server.Close()
+
+	for _, skip := range []bool{false, true} {
+		scrapper := NewScrapper(nil).WithThreads(2).WithNearDuplicates(NearDuplicateConfig{Threshold: DefaultNearDuplicateThreshold, Skip: skip})
+		scrapper.Start()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		scrape := func(path string) (*JobHandle, *testingCallbackAnalyzer) {
+			analyzer := &testingCallbackAnalyzer{}
+			handle, err := scrapper.ScrapeContext(ctx, server.URL+path, analyzer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handle.Wait(ctx)
+			if err := ctx.Err(); err != nil {
+				t.Fatal(err)
+			}
+			return handle, analyzer
+		}
+
+		if handle, _ := scrape("/article"); handle.Status() != JobDone || handle.Page().Fingerprint == 0 || handle.Page().NearDuplicate != nil {
+			t.Fatalf("unexpected job outcome. status %v, page %+v", handle.Status(), handle.Page())
+		}
+		if handle, _ := scrape("/other"); handle.Status() != JobDone || handle.Page().NearDuplicate != nil {
+			t.Fatalf("unexpected job outcome. status %v, page %+v", handle.Status(), handle.Page())
+		}
+
+		handle, analyzer := scrape("/article/print")
+		dup := handle.Page().NearDuplicate
+		if dup == nil || dup.URL != server.URL+"/article" || dup.Distance > DefaultNearDuplicateThreshold {
+			t.Fatalf("near duplicate not detected %+v", dup)
+		}
+		if skip && (handle.Status() != JobDropped || !errors.Is(handle.Err(), ErrDuplicate) || !errors.Is(analyzer.err, ErrNearDuplicate)) {
+			t.Fatalf("near duplicate not skipped. status %v, err %v", handle.Status(), handle.Err())
+		}
+		if !skip && (handle.Status() != JobDone || analyzer.page == "") {
+			t.Fatalf("near duplicate not analyzed. status %v, err %v", handle.Status(), handle.Err())
+		}
+
+		// other sessions have their own fingerprints
+		session := scrapper.NewSession(SessionConfig{Name: "other"})
+		handle, err := session.ScrapeContext(ctx, server.URL+"/article/print", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle.Wait(ctx)
+		if handle.Status() != JobDone || handle.Page().NearDuplicate != nil {
+			t.Fatalf("near duplicate of other session detected. status %v, page %+v", handle.Status(), handle.Page())
+		}
+		session.Close()
+		cancel()
+		scrapper.Stop()
+	}
+}
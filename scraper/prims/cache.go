@@ -65,6 +65,19 @@ func (e *SimpleEvictableCache[T, Y]) Evict() {
 	e.tryEvict()
 }
 
+// Range calls fn for every item held in the cache together with its eviction deadline.
+// A zero deadline means that the item is never evicted.
+func (e *SimpleEvictableCache[T, Y]) Range(fn func(key T, value Y, deadline time.Time)) {
+	for key, item := range e.m {
+		fn(key, item.V, item.deadline)
+	}
+}
+
+// Len returns the amount of items held in the cache.
+func (e *SimpleEvictableCache[T, Y]) Len() int {
+	return len(e.m)
+}
+
 // EvictSize returns the size of evictable items.
 func (e *SimpleEvictableCache[T, Y]) EvictSize() int {
 	return len(e.q)
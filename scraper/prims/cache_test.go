@@ -69,3 +69,25 @@ func TestEvictableCache(t *testing.T) {
 		<-evictedCh
 	}
 }
+
+// TestEvictableCacheRange checks that Range visits every item exactly once together with its deadline.
+func TestEvictableCacheRange(t *testing.T) {
+	cache := NewSimpleEvictableCache[string, int](nil)
+	deadline := time.Now().Add(time.Hour)
+	cache.AddIfNotSeen("foo", 1, deadline)
+	cache.AddIfNotSeen("bar", 2, time.Time{})
+
+	visited := make(map[string]time.Time)
+	cache.Range(func(key string, _ int, deadline time.Time) {
+		visited[key] = deadline
+	})
+	if len(visited) != cache.Len() {
+		t.Fatalf("unexpected items visited. got %v, want %v", len(visited), cache.Len())
+	}
+	if !visited["foo"].Equal(deadline) {
+		t.Fatalf("unexpected deadline. got %v, want %v", visited["foo"], deadline)
+	}
+	if !visited["bar"].IsZero() {
+		t.Fatalf("unexpected deadline. got %v, want zero", visited["bar"])
+	}
+}
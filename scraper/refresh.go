@@ -0,0 +1,208 @@
+package scraper
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+// RefreshConfig configures the refresh mode, in which every scraped url is scraped again once its refresh interval passes.
+// Every refresh is analyzed by a new analyzer, created by the factory set for the url with SetRefreshFactory or by Factory.
+// The analyzer of the previous scrape is never reused, as analyzers may expect to be called only once.
+// The interval of every url adapts between MinInterval and MaxInterval: it is lengthened by Backoff
+// when the content is unchanged since the previous scrape and shortened by Backoff when it changed.
+type RefreshConfig struct {
+	Factory     func(url string) analytics.Analyzer // creates the analyzer of every refresh of the urls without their own factory, nil means no analyzer
+	Interval    time.Duration                       // initial refresh interval, defaults to 1 hour
+	MinInterval time.Duration                       // defaults to Interval
+	MaxInterval time.Duration                       // defaults to Interval
+	Backoff     float64                             // factor of the interval adaptation, defaults to 2
+}
+
+// withDefaults returns the config with the missing values filled in.
+func (c RefreshConfig) withDefaults() RefreshConfig {
+	if c.Factory == nil {
+		c.Factory = func(string) analytics.Analyzer { return nil }
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+	if c.MinInterval <= 0 || c.MinInterval > c.Interval {
+		c.MinInterval = c.Interval
+	}
+	if c.MaxInterval < c.Interval {
+		c.MaxInterval = c.Interval
+	}
+	if c.Backoff <= 1 {
+		c.Backoff = 2
+	}
+	return c
+}
+
+// refreshState is the refresh state of a single url.
+type refreshState struct {
+	interval time.Duration
+	fixed    bool   // interval set explicitly, not adapted
+	hash     uint64 // hash of the last scraped content
+	scraped  bool
+	factory  func(url string) analytics.Analyzer // creates the analyzers of the refreshes, nil uses the factory of the config
+}
+
+// refresher keeps the refresh intervals of the urls of a session.
+type refresher struct {
+	cfg RefreshConfig
+
+	mu   sync.Mutex // mutex protecting urls
+	urls map[string]*refreshState
+}
+
+func newRefresher(cfg RefreshConfig) *refresher {
+	return &refresher{cfg: cfg.withDefaults(), urls: make(map[string]*refreshState)}
+}
+
+// interval returns the current refresh interval of the url.
+func (r *refresher) interval(url string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state, ok := r.urls[url]; ok {
+		return state.interval
+	}
+	return r.cfg.Interval
+}
+
+// setInterval fixes the refresh interval of the url.
+func (r *refresher) setInterval(url string, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.state(url)
+	state.interval, state.fixed = interval, true
+}
+
+// setFactory sets the factory creating the analyzers of the refreshes of the url.
+func (r *refresher) setFactory(url string, factory func(url string) analytics.Analyzer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state(url).factory = factory
+}
+
+// analyzer returns a new analyzer for the next refresh of the url, created by its factory or the factory of the config.
+func (r *refresher) analyzer(url string) analytics.Analyzer {
+	factory := r.cfg.Factory
+	r.mu.Lock()
+	if state, ok := r.urls[url]; ok && state.factory != nil {
+		factory = state.factory
+	}
+	r.mu.Unlock()
+	return factory(url)
+}
+
+// observe adapts the interval of the url to the change of its content.
+func (r *refresher) observe(url string, body string) {
+	h := fnv.New64a()
+	h.Write([]byte(body))
+	hash := h.Sum64()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state := r.state(url)
+	changed := state.scraped && state.hash != hash
+	unchanged := state.scraped && state.hash == hash
+	state.hash, state.scraped = hash, true
+	if state.fixed {
+		return
+	}
+	switch {
+	case unchanged:
+		state.interval = time.Duration(float64(state.interval) * r.cfg.Backoff)
+	case changed:
+		state.interval = time.Duration(float64(state.interval) / r.cfg.Backoff)
+	}
+	if state.interval < r.cfg.MinInterval {
+		state.interval = r.cfg.MinInterval
+	}
+	if state.interval > r.cfg.MaxInterval {
+		state.interval = r.cfg.MaxInterval
+	}
+}
+
+// state returns the state of the url. Must be called with mu held.
+func (r *refresher) state(url string) *refreshState {
+	state, ok := r.urls[url]
+	if !ok {
+		state = &refreshState{interval: r.cfg.Interval}
+		r.urls[url] = state
+	}
+	return state
+}
+
+// WithRefresh enables the refresh mode of the urls submitted through the scrapper. It must be called before Start.
+func (s *Scrapper) WithRefresh(cfg RefreshConfig) *Scrapper {
+	s.session.enableRefresh(cfg)
+	return s
+}
+
+// SetRefreshInterval fixes the refresh interval of the url submitted through the scrapper, disabling its adaptation.
+// It applies from the next scrape of the url. Has no effect unless the refresh mode is enabled.
+func (s *Scrapper) SetRefreshInterval(url string, interval time.Duration) {
+	s.session.SetRefreshInterval(url, interval)
+}
+
+// SetRefreshInterval fixes the refresh interval of the url, disabling its adaptation.
+// It applies from the next scrape of the url. Has no effect unless the refresh mode is enabled.
+func (s *Session) SetRefreshInterval(url string, interval time.Duration) {
+	if s.refresh != nil {
+		s.refresh.setInterval(url, interval)
+	}
+}
+
+// SetRefreshFactory sets the factory creating the analyzers of the refreshes of the url submitted through the scrapper,
+// in place of RefreshConfig.Factory. Has no effect unless the refresh mode is enabled.
+func (s *Scrapper) SetRefreshFactory(url string, factory func(url string) analytics.Analyzer) {
+	s.session.SetRefreshFactory(url, factory)
+}
+
+// SetRefreshFactory sets the factory creating the analyzers of the refreshes of the url, in place of RefreshConfig.Factory.
+// Has no effect unless the refresh mode is enabled.
+func (s *Session) SetRefreshFactory(url string, factory func(url string) analytics.Analyzer) {
+	if s.refresh != nil {
+		s.refresh.setFactory(url, factory)
+	}
+}
+
+// enableRefresh enables the refresh mode of the session.
+func (s *Session) enableRefresh(cfg RefreshConfig) {
+	s.refresh = newRefresher(cfg)
+	s.scrapper.refreshMu.Lock()
+	s.scrapper.refreshing = append(s.scrapper.refreshing, s)
+	s.scrapper.refreshMu.Unlock()
+}
+
+// evicted is called by the eventLoop when the url is evicted from the seen urls of the session.
+// In the refresh mode the url is scheduled for scraping again, unless the session is closed or the scrapper is draining.
+func (s *Session) evicted(url string, _ struct{}) {
+	if s.refresh == nil || s.scrapper.draining.Load() {
+		return
+	}
+	analyzer := s.refresh.analyzer(url)
+	targets, err := s.register(context.Background(), []string{url}, analyzer)
+	if err != nil {
+		// closed, no more refreshes
+		cancelAnalyzer(analyzer, 1, err)
+		return
+	}
+	s.scrapper.refreshed = append(s.scrapper.refreshed, targets...)
+}
+
+// evictRefreshing evicts outdated urls of the sessions in the refresh mode, scheduling them for scraping again.
+// Must be called by the eventLoop.
+func (s *Scrapper) evictRefreshing() {
+	s.refreshMu.Lock()
+	sessions := s.refreshing
+	s.refreshMu.Unlock()
+	for _, session := range sessions {
+		session.seen.Evict()
+	}
+}
@@ -0,0 +1,113 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+// TestRefresher checks that the refresh interval lengthens for unchanged content and shortens for changed one.
+func TestRefresher(t *testing.T) {
+	r := newRefresher(RefreshConfig{Interval: 4 * time.Second, MinInterval: time.Second, MaxInterval: 8 * time.Second})
+
+	steps := []struct {
+		body string
+		want time.Duration
+	}{
+		{body: "a", want: 4 * time.Second}, // first scrape, nothing to compare with
+		{body: "a", want: 8 * time.Second},
+		{body: "a", want: 8 * time.Second}, // bounded by max
+		{body: "b", want: 4 * time.Second},
+		{body: "c", want: 2 * time.Second},
+		{body: "d", want: time.Second},
+		{body: "e", want: time.Second}, // bounded by min
+	}
+	for i, step := range steps {
+		r.observe("url", step.body)
+		if got := r.interval("url"); got != step.want {
+			t.Fatalf("unexpected interval after step %v. got %v, want %v", i, got, step.want)
+		}
+	}
+
+	r.setInterval("url", time.Minute)
+	r.observe("url", "f")
+	if got := r.interval("url"); got != time.Minute {
+		t.Fatalf("fixed interval adapted. got %v, want %v", got, time.Minute)
+	}
+}
+
+// TestScrapeRefresh checks that scraped urls are scraped again with new analyzers once their refresh interval passes.
+func TestScrapeRefresh(t *testing.T) {
+	var fetches atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+	}))
+	defer server.Close()
+
+	var analyzers atomic.Int64
+	scrapper := NewScrapper(nil).WithThreads(1).WithRefresh(RefreshConfig{
+		Factory: func(string) analytics.Analyzer {
+			analyzers.Add(1)
+			return &testingCallbackAnalyzer{}
+		},
+		Interval: 10 * time.Millisecond,
+	})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	if _, err := scrapper.Scrape(server.URL+"/page", nil); err != nil {
+		t.Fatal(err)
+	}
+	// eviction is checked by the retry ticker
+	for deadline := time.Now().Add(15 * time.Second); fetches.Load() < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("url not refreshed. fetches %v", fetches.Load())
+		}
+	}
+	if analyzers.Load() == 0 {
+		t.Fatal("refresh analyzer not created")
+	}
+}
+
+// TestRefreshAnalyzer checks that the refreshes are analyzed by new analyzers of the factory of the url,
+// never by the analyzer of the previous scrape.
+func TestRefreshAnalyzer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var created atomic.Int64
+	scrapper := NewScrapper(nil).WithThreads(1).WithRefresh(RefreshConfig{
+		Factory: func(string) analytics.Analyzer {
+			created.Add(1)
+			return nil
+		},
+		Interval: 10 * time.Millisecond,
+	})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	var refreshed atomic.Int64
+	scrapper.SetRefreshFactory(server.URL+"/page", func(string) analytics.Analyzer {
+		return &testingCallbackAnalyzer{callback: func() { refreshed.Add(1) }}
+	})
+	var analyzed atomic.Int64
+	analyzer := &testingCallbackAnalyzer{callback: func() { analyzed.Add(1) }}
+	if _, err := scrapper.Scrape(server.URL+"/page", analyzer); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(15 * time.Second); refreshed.Load() < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh not analyzed by the factory of the url. analyzed %v", refreshed.Load())
+		}
+	}
+	if analyzed.Load() != 1 {
+		t.Fatalf("analyzer of the previous scrape reused. analyzed %v", analyzed.Load())
+	}
+	if created.Load() != 0 {
+		t.Fatalf("unexpected analyzers created by the factory of the config %v", created.Load())
+	}
+}
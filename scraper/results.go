@@ -0,0 +1,134 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/prims"
+)
+
+// Result represents the outcome of a single finished scrape job.
+type Result struct {
+	JobID    uint64
+	URL      string
+	Page     *Page // nil if the page wasn't fetched
+	Err      error
+	Attempt  int           // how many times the job was started by a worker
+	Duration time.Duration // time from the submission until the job finished
+}
+
+// resultStream delivers results to the consumer without blocking the publishers.
+// Results are buffered in a queue and pumped into the output channel of configured capacity.
+// Queued results take up the backlog, so that the producers wait for a slow consumer instead of the queue growing without limit.
+type resultStream struct {
+	backlog *backlog // backlog of the scrapper, holding the queued results
+
+	mu     sync.Mutex // mutex protecting fields below
+	queue  prims.Queue[Result]
+	closed bool // no more results will be published
+
+	wake chan struct{}
+	out  chan Result
+}
+
+func newResultStream(buffer int, backlog *backlog) *resultStream {
+	r := &resultStream{
+		backlog: backlog,
+		queue:   make(prims.Queue[Result], 0),
+		wake:    make(chan struct{}, 1),
+		out:     make(chan Result, buffer),
+	}
+	go r.pump()
+	return r
+}
+
+// publish adds the result to the stream. Results published after close are discarded.
+func (r *resultStream) publish(result Result) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	// taken up before the pump may release it
+	r.backlog.add(1)
+	r.queue.Push(result)
+	r.mu.Unlock()
+	r.notify()
+}
+
+// close marks the stream as finished. The output channel is closed once all published results are delivered.
+func (r *resultStream) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.notify()
+}
+
+func (r *resultStream) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pump moves results from the queue to the output channel.
+func (r *resultStream) pump() {
+	for {
+		r.mu.Lock()
+		result, ok := r.queue.Pop()
+		closed := r.closed
+		r.mu.Unlock()
+
+		if ok {
+			r.out <- result
+			r.backlog.release(1)
+			continue
+		}
+		if closed {
+			close(r.out)
+			return
+		}
+		<-r.wake
+	}
+}
+
+// ResultIterator iterates over the results of the scrapper.
+//
+//	it := scrapper.ResultIterator()
+//	for it.Next(ctx) {
+//		result := it.Result()
+//	}
+//	if err := it.Err(); err != nil {
+//		// ctx done before the scrapper stopped
+//	}
+type ResultIterator struct {
+	ch      <-chan Result
+	current Result
+	err     error
+}
+
+// Next waits for the next result. It returns false once the scrapper is stopped and all results were delivered,
+// or when ctx is done.
+func (it *ResultIterator) Next(ctx context.Context) bool {
+	if it.err != nil || it.ch == nil {
+		return false
+	}
+	select {
+	case <-ctx.Done():
+		it.err = ctx.Err()
+		return false
+	case result, ok := <-it.ch:
+		if !ok {
+			return false
+		}
+		it.current = result
+		return true
+	}
+}
+
+// Result returns the result fetched by the last Next call.
+func (it *ResultIterator) Result() Result { return it.current }
+
+// Err returns the ctx error if the iteration was interrupted.
+func (it *ResultIterator) Err() error { return it.err }
@@ -0,0 +1,113 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestResults checks that every submitted job yields exactly one result, including duplicates and jobs cancelled at Stop.
+func TestResults(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("foo"))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	scrapper := NewScrapper(nil).WithThreads(1).WithResults(0)
+	scrapper.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	it := scrapper.ResultIterator()
+
+	if _, err := scrapper.ScrapeContext(ctx, server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next(ctx) {
+		t.Fatal("missing result", it.Err())
+	}
+	if result := it.Result(); result.Err != nil || result.Page.Body != "foo" || result.Attempt != 1 || result.URL != server.URL {
+		t.Fatalf("unexpected result. got %+v", result)
+	}
+
+	if _, err := scrapper.ScrapeContext(ctx, server.URL, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !it.Next(ctx) {
+		t.Fatal("missing result", it.Err())
+	}
+	if result := it.Result(); !errors.Is(result.Err, ErrDuplicate) {
+		t.Fatalf("unexpected result error. got %v, want %v", result.Err, ErrDuplicate)
+	}
+
+	// one running and one queued job are cancelled at stop
+	if _, err := scrapper.ScrapeMultiContext(ctx, []string{server.URL + "/slow", server.URL + "/queued"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	scrapper.Stop()
+
+	cancelled := 0
+	for result := range scrapper.Results() {
+		if result.Err == nil {
+			t.Fatalf("unexpected result. got %+v", result)
+		}
+		cancelled++
+	}
+	if cancelled != 2 {
+		t.Fatalf("unexpected amount of results. got %v, want %v", cancelled, 2)
+	}
+}
+
+// TestResultsBackpressure checks that the results waiting for the consumer take up the backlog.
+func TestResultsBackpressure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1).WithMaxBacklog(2).WithResults(0)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := scrapper.ScrapeMultiContext(ctx, []string{server.URL + "/a", server.URL + "/b"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for scrapper.Stats().Backlog != 2 || scrapper.Stats().InFlight != 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("results not held in the backlog %+v", scrapper.Stats())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if _, err := scrapper.TryScrape(server.URL+"/c", nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("unexpected error of full backlog. got %v, want %v", err, ErrQueueFull)
+	}
+
+	// consumed result frees its place
+	it := scrapper.ResultIterator()
+	if !it.Next(ctx) {
+		t.Fatal("missing result", it.Err())
+	}
+	for {
+		if _, err := scrapper.TryScrape(server.URL+"/c", nil); err == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("consumed result didn't free the backlog")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
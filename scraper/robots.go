@@ -0,0 +1,141 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Exca-DK/webscraper/scraper/html"
+)
+
+var (
+	// ErrNoindex is the error of jobs whose page is marked noindex. The page is fetched, but not analyzed.
+	ErrNoindex = errors.New("page marked noindex")
+	// ErrCanonicalDuplicate is the error of jobs whose canonical url was already scraped through another url.
+	ErrCanonicalDuplicate = fmt.Errorf("%w through its canonical url", ErrDuplicate)
+)
+
+// RobotsConfig selects the directives of the pages honored by the scrapper.
+type RobotsConfig struct {
+	Noindex   bool // pages marked noindex are fetched, but not passed to the analyzers
+	Nofollow  bool // links of pages marked nofollow and rel=nofollow links are left out of Page.FollowLinks
+	Canonical bool // pages whose canonical url was already scraped by the session are dropped as duplicates
+}
+
+func (cfg RobotsConfig) enabled() bool {
+	return cfg.Noindex || cfg.Nofollow || cfg.Canonical
+}
+
+// Directives are the instructions of the page for crawlers, from its <meta name="robots">, X-Robots-Tag header and <link rel="canonical">.
+type Directives struct {
+	NoIndex   bool
+	NoFollow  bool
+	Canonical string // absolute canonical url, empty if the page has none
+}
+
+// ParseDirectives returns the directives of the page. X-Robots-Tag directives addressed to specific crawlers are ignored.
+func ParseDirectives(page *Page) Directives {
+	var d Directives
+	meta := html.ExtractMeta(page.Body)
+	robots := meta.Robots
+	for _, value := range page.Header.Values("X-Robots-Tag") {
+		for _, directive := range strings.Split(strings.ToLower(value), ",") {
+			directive = strings.TrimSpace(directive)
+			// eg. "googlebot: noindex"
+			if agent, rest, ok := strings.Cut(directive, ":"); ok && !strings.ContainsAny(agent, " ") && agent != "unavailable_after" {
+				if agent != "*" {
+					continue
+				}
+				directive = strings.TrimSpace(rest)
+			}
+			robots = append(robots, directive)
+		}
+	}
+	for _, directive := range robots {
+		switch directive {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex, d.NoFollow = true, true
+		}
+	}
+	if meta.Canonical != "" {
+		if base, err := url.Parse(page.URL); err == nil {
+			if canonical, err := base.Parse(meta.Canonical); err == nil && (canonical.Scheme == "http" || canonical.Scheme == "https") {
+				canonical.Fragment, canonical.RawFragment = "", ""
+				d.Canonical = canonical.String()
+			}
+		}
+	}
+	return d
+}
+
+// FollowLinks returns the links of the page that a crawl should follow.
+// If the scrapper honors nofollow, links of pages marked nofollow and rel=nofollow links are left out.
+func (p *Page) FollowLinks() []html.Link {
+	if p.nofollow && p.Directives.NoFollow {
+		return nil
+	}
+	links, err := html.ExtractLinks(p.Body, p.URL)
+	if err != nil || !p.nofollow {
+		return links
+	}
+	followed := links[:0]
+	for _, link := range links {
+		if !link.HasRel("nofollow") {
+			followed = append(followed, link)
+		}
+	}
+	return followed
+}
+
+// WithRobots configures the page directives honored by the scrapper. By default all of them are ignored.
+func (s *Scrapper) WithRobots(cfg RobotsConfig) *Scrapper {
+	s.robots = cfg
+	return s
+}
+
+// applyRobots parses the directives of the fetched page and returns the error the job should be dropped with, if any.
+func (s *Scrapper) applyRobots(target scrapeTarget, page *Page) error {
+	if !s.robots.enabled() {
+		return nil
+	}
+	page.Directives = ParseDirectives(page)
+	page.nofollow = s.robots.Nofollow
+	if s.robots.Canonical && !target.session.canonicals.claim(page.Directives.Canonical, target.url) {
+		return ErrCanonicalDuplicate
+	}
+	if s.robots.Noindex && page.Directives.NoIndex {
+		return ErrNoindex
+	}
+	return nil
+}
+
+// canonicals maps the canonical urls to the first url they were scraped through.
+type canonicals struct {
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+// claim claims the canonical url for the url. Pages without a canonical url are their own canonical url.
+// Returns false if the canonical url was already claimed by another url.
+func (c *canonicals) claim(canonical, url string) bool {
+	if canonical == "" {
+		canonical = url
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.urls == nil {
+		c.urls = make(map[string]string)
+	}
+	claimed, ok := c.urls[canonical]
+	if !ok {
+		c.urls[canonical] = url
+		return true
+	}
+	return claimed == url
+}
@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRobots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/meta":
+			io.WriteString(w, `<head><meta name="robots" content="noindex"></head>`)
+		case "/header":
+			w.Header().Set("X-Robots-Tag", "googlebot: nofollow, *: noindex")
+		case "/other-agent":
+			w.Header().Set("X-Robots-Tag", "googlebot: noindex")
+		case "/", "/index.html":
+			io.WriteString(w, `<head><link rel="canonical" href="/"></head><a href="/a">a</a><a href="/b" rel="nofollow">b</a>`)
+		case "/nofollow":
+			io.WriteString(w, `<head><meta name="robots" content="nofollow"></head><a href="/a">a</a>`)
+		}
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(4).WithRobots(RobotsConfig{Noindex: true, Nofollow: true, Canonical: true})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	scrape := func(path string) (*JobHandle, *testingCallbackAnalyzer) {
+		analyzer := &testingCallbackAnalyzer{}
+		handle, err := scrapper.ScrapeContext(ctx, server.URL+path, analyzer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle.Wait(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return handle, analyzer
+	}
+
+	// noindex pages are fetched, but not analyzed
+	for _, path := range []string{"/meta", "/header"} {
+		handle, analyzer := scrape(path)
+		if handle.Status() != JobDropped || !errors.Is(handle.Err(), ErrNoindex) || !errors.Is(analyzer.err, ErrNoindex) {
+			t.Fatalf("unexpected job outcome of %v. status %v, err %v", path, handle.Status(), handle.Err())
+		}
+		if !handle.Page().Directives.NoIndex {
+			t.Fatalf("unexpected directives of %v: %+v", path, handle.Page().Directives)
+		}
+	}
+	if handle, _ := scrape("/other-agent"); handle.Status() != JobDone {
+		t.Fatalf("directives of other crawlers honored. status %v, err %v", handle.Status(), handle.Err())
+	}
+
+	// the canonical url is scraped once, no matter the url it was reached through
+	handle, _ := scrape("/index.html")
+	if handle.Status() != JobDone || handle.Page().Directives.Canonical != server.URL+"/" {
+		t.Fatalf("unexpected job outcome. status %v, directives %+v", handle.Status(), handle.Page().Directives)
+	}
+	links := handle.Page().FollowLinks()
+	if len(links) != 1 || links[0].URL != server.URL+"/a" {
+		t.Fatalf("unexpected followed links %+v", links)
+	}
+	handle, _ = scrape("/")
+	if handle.Status() != JobDropped || !errors.Is(handle.Err(), ErrCanonicalDuplicate) || !errors.Is(handle.Err(), ErrDuplicate) {
+		t.Fatalf("unexpected job outcome. status %v, err %v", handle.Status(), handle.Err())
+	}
+
+	if handle, _ := scrape("/nofollow"); len(handle.Page().FollowLinks()) != 0 {
+		t.Fatalf("links of nofollow page followed")
+	}
+}
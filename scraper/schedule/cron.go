@@ -0,0 +1,201 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes the times of recurring runs.
+type Schedule interface {
+	// Next returns the first run time after t.
+	Next(t time.Time) time.Time
+}
+
+// Parse parses the schedule expression. Supported are the standard five field cron expressions
+// "minute hour day-of-month month day-of-week", with lists, ranges, steps and month and day names,
+// eg. "0 6 * * MON-FRI" or "*/15 * * * *", and the descriptors @yearly, @monthly, @weekly, @daily, @hourly
+// and "@every <duration>", eg. "@every 15m".
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expr, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("invalid schedule %q: interval shorter than a second", expr)
+		}
+		return every(d), nil
+	}
+	if descriptor, ok := descriptors[expr]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	s := &cron{}
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		b    bounds
+	}{
+		{&s.minute, minutes},
+		{&s.hour, hours},
+		{&s.dom, doms},
+		{&s.month, months},
+		{&s.dow, dows},
+	} {
+		if *f.bits, err = parseField(fields[i], f.b); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+	}
+	// sunday can be written as 7 as well
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// every is a schedule of runs in a fixed interval.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// bounds are the allowed values of a cron field.
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minutes = bounds{min: 0, max: 59}
+	hours   = bounds{min: 0, max: 23}
+	doms    = bounds{min: 1, max: 31}
+	months  = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dows = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// parseField parses the comma separated list of ranges into the bitset of allowed values.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*":
+			lo, hi = b.min, b.max
+		case strings.Contains(rng, "-"):
+			i := strings.Index(rng, "-")
+			var err error
+			if lo, err = b.value(rng[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = b.value(rng[i+1:]); err != nil {
+				return 0, err
+			}
+		default:
+			var err error
+			if lo, err = b.value(rng); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// "5/10" means from 5 to the end with step 10
+			if step > 1 {
+				hi = b.max
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid range %q", rng)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value of the field.
+func (b bounds) value(s string) (int, error) {
+	v, ok := b.names[strings.ToLower(s)]
+	if !ok {
+		var err error
+		if v, err = strconv.Atoi(s); err != nil {
+			return 0, fmt.Errorf("invalid value %q", s)
+		}
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", s, b.min, b.max)
+	}
+	return v, nil
+}
+
+// cron is a schedule of a cron expression, holding the allowed values of every field as bitsets.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// maxSearch bounds the search of the next run, so that expressions that never match, eg. "0 0 30 2 *", terminate.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+func (c *cron) Next(t time.Time) time.Time {
+	// runs happen at full minutes
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t is allowed. Like in cron, if both day of month and day of week
+// are restricted, the day matches when either of them does.
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
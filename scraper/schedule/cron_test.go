@@ -0,0 +1,42 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// wednesday
+	from := time.Date(2024, time.January, 3, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2024, time.January, 3, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2024, time.January, 3, 10, 15, 0, 0, time.UTC)},
+		{expr: "0 6 * * MON-FRI", want: time.Date(2024, time.January, 4, 6, 0, 0, 0, time.UTC)},
+		{expr: "0 6 * * sat,sun", want: time.Date(2024, time.January, 6, 6, 0, 0, 0, time.UTC)},
+		{expr: "30 9 1 * *", want: time.Date(2024, time.February, 1, 9, 30, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 12 15 * 7", want: time.Date(2024, time.January, 7, 12, 0, 0, 0, time.UTC)}, // day of month or sunday
+		{expr: "5/20 10-11 * * *", want: time.Date(2024, time.January, 3, 10, 25, 0, 0, time.UTC)},
+		{expr: "@daily", want: time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{expr: "@every 15m", want: from.Add(15 * time.Minute)},
+		{expr: "0 0 30 2 *", want: time.Time{}}, // never
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("failed parsing %q: %v", test.expr, err)
+		}
+		if got := schedule.Next(from); !got.Equal(test.want) {
+			t.Fatalf("unexpected next run of %q. got %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * foo *", "*/0 * * * *", "5-1 * * * *", "@every 1ms", "@every x"} {
+		if _, err := Parse(expr); err == nil {
+			t.Fatalf("parsed invalid schedule %q", expr)
+		}
+	}
+}
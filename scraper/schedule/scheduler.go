@@ -0,0 +1,265 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/clock"
+	"github.com/Exca-DK/webscraper/log"
+	"github.com/Exca-DK/webscraper/scraper"
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+var _ Target = (*scraper.Scrapper)(nil)
+
+// Target is the scrapper driven by the scheduler. Scheduled urls are scraped even if they were already seen.
+type Target interface {
+	Rescrape(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*scraper.JobHandle, error)
+}
+
+// MissedPolicy decides what happens with the runs missed because the scheduler wasn't running at their time.
+type MissedPolicy int
+
+const (
+	MissedSkip    MissedPolicy = iota // missed runs are skipped, the job waits for its next regular run
+	MissedRunOnce                     // a single run is made right away, no matter how many runs were missed
+)
+
+// maxCatchUp bounds the amount of missed runs counted for a single job.
+const maxCatchUp = 100
+
+// Job is a group of urls scraped on the same schedule.
+type Job struct {
+	Name     string
+	URLs     []string
+	Schedule string // expression accepted by Parse
+	Missed   MissedPolicy
+	// LastRun is the time of the last run before the scheduler was started, used for finding the missed runs.
+	// Zero takes the last run saved in the state store, if any, otherwise the job didn't run yet, so no runs were missed.
+	LastRun time.Time
+	Factory func(url string) analytics.Analyzer // creates the analyzer of every scrape, nil means no analyzer
+}
+
+// NextRun describes the upcoming run of the job.
+type NextRun struct {
+	Name    string
+	URLs    []string
+	At      time.Time // zero if the schedule never runs again
+	LastRun time.Time
+	Missed  int // runs missed before the last check of the job, made up by a single run unless skipped
+}
+
+// entry is a job registered in the scheduler.
+type entry struct {
+	job      Job
+	schedule Schedule
+	next     time.Time
+	missed   int // runs missed before the last check of the job
+}
+
+// Scheduler scrapes the urls of the jobs at the times of their schedules.
+// Time is taken from the clock package, so the scheduler can be driven by a rewindable clock.
+type Scheduler struct {
+	target Target
+	logger log.Logger
+	grace  time.Duration      // how late a run can be made by the first tick before it counts as missed
+	store  scraper.StateStore // persists the last runs of the jobs, nil if not configured
+
+	mu       sync.Mutex // mutex protecting fields below
+	entries  map[string]*entry
+	lastRuns map[string]time.Time // last runs loaded from the store, by the name of the job
+	lastTick time.Time            // time of the previous tick, zero before the first one
+}
+
+// New creates a scheduler of the target.
+func New(target Target, logger log.Logger) *Scheduler {
+	return &Scheduler{
+		target:  target,
+		logger:  logger,
+		grace:   time.Minute,
+		entries: make(map[string]*entry),
+	}
+}
+
+// WithGrace configures how late a run can be made by the first tick before it counts as missed. Defaults to one minute.
+// Later ticks count only the runs due before the previous tick as missed, so the grace doesn't depend on the tick interval.
+func (s *Scheduler) WithGrace(grace time.Duration) *Scheduler {
+	s.grace = grace
+	return s
+}
+
+// WithStateStore configures the store persisting the last runs of the jobs, so that the runs missed while the scheduler
+// wasn't running are found after a restart. The last runs saved in the store are loaded right away, so it must be called before Add.
+// The store shouldn't be the one of the scrapper checkpoints, as every save replaces the whole snapshot.
+func (s *Scheduler) WithStateStore(store scraper.StateStore) *Scheduler {
+	s.store = store
+	snapshot, err := store.Load()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn("failed loading last runs of scheduled jobs", "err:", err.Error())
+		}
+		return s
+	}
+	s.mu.Lock()
+	s.lastRuns = snapshot.LastRuns
+	s.mu.Unlock()
+	return s
+}
+
+// Add registers the job, replacing the job of the same name. Returns error if the schedule can't be parsed.
+func (s *Scheduler) Add(job Job) error {
+	schedule, err := Parse(job.Schedule)
+	if err != nil {
+		return err
+	}
+	if job.Factory == nil {
+		job.Factory = func(string) analytics.Analyzer { return nil }
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if job.LastRun.IsZero() {
+		job.LastRun = s.lastRuns[job.Name]
+	}
+	from := job.LastRun
+	if from.IsZero() {
+		from = clock.Now()
+	}
+	s.entries[job.Name] = &entry{job: job, schedule: schedule, next: schedule.Next(from)}
+	return nil
+}
+
+// Remove unregisters the job.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, name)
+}
+
+// NextRuns returns the upcoming runs of all jobs ordered by their time.
+func (s *Scheduler) NextRuns() []NextRun {
+	s.mu.Lock()
+	runs := make([]NextRun, 0, len(s.entries))
+	for _, e := range s.entries {
+		runs = append(runs, NextRun{Name: e.job.Name, URLs: e.job.URLs, At: e.next, LastRun: e.job.LastRun, Missed: e.missed})
+	}
+	s.mu.Unlock()
+	sort.Slice(runs, func(i, j int) bool {
+		// runs that never happen go last
+		if runs[i].At.IsZero() != runs[j].At.IsZero() {
+			return runs[j].At.IsZero()
+		}
+		if !runs[i].At.Equal(runs[j].At) {
+			return runs[i].At.Before(runs[j].At)
+		}
+		return runs[i].Name < runs[j].Name
+	})
+	return runs
+}
+
+// Run checks for due jobs every interval until ctx is done.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick runs the jobs that are due, applying their missed policy. Every job runs at most once per tick.
+func (s *Scheduler) tick(ctx context.Context) {
+	now := clock.Now()
+	var due []Job
+	s.mu.Lock()
+	for _, e := range s.entries {
+		if e.next.IsZero() || e.next.After(now) {
+			continue
+		}
+		// every run time that passed
+		var times []time.Time
+		next := e.next
+		for !next.IsZero() && !next.After(now) && len(times) < maxCatchUp {
+			times = append(times, next)
+			next = e.schedule.Next(next)
+		}
+		if !next.IsZero() && !next.After(now) {
+			// too many missed runs, continue from now
+			next = e.schedule.Next(now)
+		}
+		e.next = next
+
+		// runs before the last one are missed, the last one as well if it was due before the previous tick,
+		// so the scheduler wasn't running at its time
+		since := s.lastTick
+		if since.IsZero() {
+			since = now.Add(-s.grace)
+		}
+		late := times[len(times)-1].Before(since)
+		missed := len(times) - 1
+		if late {
+			missed++
+		}
+		e.missed = missed
+		if e.job.Missed == MissedSkip {
+			if missed > 0 {
+				s.logger.Info("skipped missed scheduled runs", "job:", e.job.Name, "missed:", missed)
+			}
+			if late {
+				continue
+			}
+		} else if missed > 0 {
+			s.logger.Info("making up missed scheduled runs", "job:", e.job.Name, "missed:", missed)
+		}
+		e.job.LastRun = now
+		due = append(due, e.job)
+	}
+	s.lastTick = now
+	lastRuns := s.lastRunsLocked()
+	s.mu.Unlock()
+
+	if len(due) > 0 {
+		s.save(lastRuns)
+	}
+	// scrape outside of the lock, submissions may block on a full backlog
+	for _, job := range due {
+		s.logger.Debug("running scheduled job", "job:", job.Name, "urls:", len(job.URLs))
+		for _, url := range job.URLs {
+			if _, err := s.target.Rescrape(ctx, []string{url}, job.Factory(url)); err != nil {
+				s.logger.Warn("failed submitting scheduled scrape", "job:", job.Name, "url:", url, "err:", err.Error())
+			}
+		}
+	}
+}
+
+// lastRunsLocked returns the last runs of the jobs by their name, including the ones loaded for the jobs that weren't added.
+// Must be called with mu held.
+func (s *Scheduler) lastRunsLocked() map[string]time.Time {
+	lastRuns := make(map[string]time.Time, len(s.entries))
+	for name, lastRun := range s.lastRuns {
+		lastRuns[name] = lastRun
+	}
+	for name, e := range s.entries {
+		if !e.job.LastRun.IsZero() {
+			lastRuns[name] = e.job.LastRun
+		}
+	}
+	return lastRuns
+}
+
+// save persists the last runs of the jobs, unless the state store isn't configured.
+func (s *Scheduler) save(lastRuns map[string]time.Time) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Save(scraper.Snapshot{SavedAt: clock.Now(), LastRuns: lastRuns}); err != nil {
+		s.logger.Warn("failed saving last runs of scheduled jobs", "err:", err.Error())
+	}
+}
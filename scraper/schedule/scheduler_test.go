@@ -0,0 +1,189 @@
+package schedule
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/clock"
+	"github.com/Exca-DK/webscraper/log"
+	"github.com/Exca-DK/webscraper/scraper"
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+// countingTarget counts the scrapes of every url.
+type countingTarget struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *countingTarget) Rescrape(_ context.Context, urls []string, _ analytics.Analyzer) ([]*scraper.JobHandle, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, url := range urls {
+		c.counts[url]++
+	}
+	return nil, nil
+}
+
+func (c *countingTarget) take() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.counts
+	c.counts = make(map[string]int)
+	return counts
+}
+
+func TestScheduler(t *testing.T) {
+	current := clock.CurrentClock()
+	defer clock.SetClock(current)
+	testingClock := clock.NewRewindableClock()
+	clock.SetClock(testingClock)
+
+	start := time.Date(2024, time.January, 3, 10, 0, 0, 0, time.UTC)
+	testingClock.Rewind(start)
+	target := &countingTarget{counts: make(map[string]int)}
+	scheduler := New(target, log.NewLogger(log.Warn, io.Discard))
+
+	// scheduler was down for an hour
+	lastRun := start.Add(-time.Hour)
+	for _, job := range []Job{
+		{Name: "quarter", URLs: []string{"a", "b"}, Schedule: "*/15 * * * *"},
+		{Name: "skip", URLs: []string{"skip"}, Schedule: "*/15 * * * *", LastRun: lastRun, Missed: MissedSkip},
+		{Name: "once", URLs: []string{"once"}, Schedule: "*/15 * * * *", LastRun: lastRun, Missed: MissedRunOnce},
+	} {
+		if err := scheduler.Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := scheduler.Add(Job{Name: "invalid", Schedule: "foo"}); err == nil {
+		t.Fatal("added job with invalid schedule")
+	}
+
+	runs := scheduler.NextRuns()
+	if len(runs) != 3 || runs[len(runs)-1].Name != "quarter" || !runs[len(runs)-1].At.Equal(start.Add(15*time.Minute)) {
+		t.Fatalf("unexpected next runs %+v", runs)
+	}
+
+	// missed runs at 9:15, 9:30 and 9:45 made up by the run at 10:00, which is on time
+	scheduler.tick(context.Background())
+	counts := target.take()
+	if counts["skip"] != 1 || counts["once"] != 1 || counts["a"] != 0 {
+		t.Fatalf("unexpected missed runs %v", counts)
+	}
+	for _, run := range scheduler.NextRuns() {
+		if want := map[string]int{"skip": 3, "once": 3}[run.Name]; run.Missed != want {
+			t.Fatalf("unexpected missed runs of %v. got %v, want %v", run.Name, run.Missed, want)
+		}
+	}
+
+	// regular run
+	testingClock.Rewind(start.Add(15*time.Minute + time.Second))
+	scheduler.tick(context.Background())
+	counts = target.take()
+	for _, url := range []string{"a", "b", "skip", "once"} {
+		if counts[url] != 1 {
+			t.Fatalf("unexpected regular runs %v", counts)
+		}
+	}
+
+	// nothing due
+	scheduler.tick(context.Background())
+	if counts := target.take(); len(counts) != 0 {
+		t.Fatalf("unexpected runs %v", counts)
+	}
+
+	// run due since the previous tick is on time, however long the tick interval
+	testingClock.Rewind(start.Add(32 * time.Minute))
+	scheduler.Remove("quarter")
+	scheduler.tick(context.Background())
+	counts = target.take()
+	if counts["skip"] != 1 || counts["once"] != 1 {
+		t.Fatalf("unexpected runs of long tick interval %v", counts)
+	}
+	if runs := scheduler.NextRuns(); len(runs) != 2 || !runs[0].At.Equal(start.Add(45*time.Minute)) || runs[0].Missed != 0 {
+		t.Fatalf("unexpected next runs %+v", runs)
+	}
+
+	// restarted after downtime longer than grace, the run of 10:45 is late
+	testingClock.Rewind(start.Add(47 * time.Minute))
+	scheduler = New(target, log.NewLogger(log.Warn, io.Discard))
+	for _, job := range []Job{
+		{Name: "skip", URLs: []string{"skip"}, Schedule: "*/15 * * * *", LastRun: start.Add(32 * time.Minute), Missed: MissedSkip},
+		{Name: "once", URLs: []string{"once"}, Schedule: "*/15 * * * *", LastRun: start.Add(32 * time.Minute), Missed: MissedRunOnce},
+	} {
+		if err := scheduler.Add(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scheduler.tick(context.Background())
+	counts = target.take()
+	if counts["skip"] != 0 || counts["once"] != 1 {
+		t.Fatalf("unexpected late runs %v", counts)
+	}
+	for _, run := range scheduler.NextRuns() {
+		if run.Missed != 1 || !run.At.Equal(start.Add(time.Hour)) {
+			t.Fatalf("unexpected next run after restart %+v", run)
+		}
+	}
+}
+
+// memoryStateStore keeps the snapshot in memory.
+type memoryStateStore struct {
+	snapshot *scraper.Snapshot
+}
+
+func (m *memoryStateStore) Save(snapshot scraper.Snapshot) error {
+	m.snapshot = &snapshot
+	return nil
+}
+
+func (m *memoryStateStore) Load() (scraper.Snapshot, error) {
+	if m.snapshot == nil {
+		return scraper.Snapshot{}, os.ErrNotExist
+	}
+	return *m.snapshot, nil
+}
+
+func TestSchedulerState(t *testing.T) {
+	current := clock.CurrentClock()
+	defer clock.SetClock(current)
+	testingClock := clock.NewRewindableClock()
+	clock.SetClock(testingClock)
+
+	start := time.Date(2024, time.January, 3, 10, 0, 0, 0, time.UTC)
+	testingClock.Rewind(start)
+	store := &memoryStateStore{}
+	job := Job{Name: "hourly", URLs: []string{"a"}, Schedule: "0 * * * *", Missed: MissedRunOnce}
+
+	target := &countingTarget{counts: make(map[string]int)}
+	scheduler := New(target, log.NewLogger(log.Warn, io.Discard)).WithStateStore(store)
+	if err := scheduler.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	testingClock.Rewind(start.Add(time.Hour))
+	scheduler.tick(context.Background())
+	if counts := target.take(); counts["a"] != 1 {
+		t.Fatalf("unexpected runs %v", counts)
+	}
+	if store.snapshot == nil || !store.snapshot.LastRuns["hourly"].Equal(start.Add(time.Hour)) {
+		t.Fatalf("last run not saved %+v", store.snapshot)
+	}
+
+	// restarted after three hours, the missed runs are found from the saved last run
+	testingClock.Rewind(start.Add(4 * time.Hour))
+	scheduler = New(target, log.NewLogger(log.Warn, io.Discard)).WithStateStore(store)
+	if err := scheduler.Add(job); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.tick(context.Background())
+	if counts := target.take(); counts["a"] != 1 {
+		t.Fatalf("unexpected runs after restart %v", counts)
+	}
+	if runs := scheduler.NextRuns(); runs[0].Missed != 2 || !runs[0].LastRun.Equal(start.Add(4*time.Hour)) {
+		t.Fatalf("unexpected next run after restart %+v", runs[0])
+	}
+}
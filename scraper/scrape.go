@@ -2,51 +2,161 @@ package scraper
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/Exca-DK/webscraper/scraper/analytics"
 )
 
-// scrapeTarget represents a target for web scraping,.l.
+// ErrRetryableStatus is the error of fetches answered with a 5xx or 429 status. Such fetches are failed attempts,
+// retried and dead-lettered like transport errors.
+var ErrRetryableStatus = errors.New("retryable status")
+
+// DefaultFetchTimeout bounds a single fetch, including the read of the body, unless changed by WithFetchTimeout.
+const DefaultFetchTimeout = 30 * time.Second
+
+// scrapeTarget represents a target for web scraping.
 type scrapeTarget struct {
-	url      string
-	analyzer analytics.Analyzer
+	url     string
+	handle  *JobHandle
+	session *Session
+	revisit bool // scraped even if already seen by the session, set for retried fetches and re-submissions
+}
+
+// Page represents the scraped web page.
+type Page struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       string
+	FetchedAt  time.Time     // time at which the fetch started
+	Duration   time.Duration // how long the fetch took
+	Directives Directives    // directives of the page, parsed only if the scrapper honors some of them
+
+	ContentHash   string         // hash of the normalized body, set only if the content is deduplicated
+	Fingerprint   uint64         // SimHash of the text of the page, set only if near duplicates are detected
+	NearDuplicate *NearDuplicate // page the page near-duplicates, nil if none
+
+	nofollow bool      // scrapper honors nofollow
+	contents *contents // content-addressed seen set of the session, nil if the content isn't deduplicated
+}
+
+// PageAnalyzer is an analyzer interested in the whole page, including its url, headers and directives.
+// The scrapper calls AnalyzePage instead of Analyze for such analyzers.
+type PageAnalyzer interface {
+	analytics.Analyzer
+	AnalyzePage(page *Page)
+}
+
+// nopAnalyzer is an analyzer that does nothing. It is used for jobs that are interested only in the page itself.
+type nopAnalyzer struct{}
+
+func (nopAnalyzer) Analyze(string) {}
+func (nopAnalyzer) Cancel(error)   {}
+
+// newTargets creates jobs of the session for each of the urls sharing the same analyzer.
+// Created jobs are tracked by the scrapper and the session until they finish.
+func (s *Scrapper) newTargets(ctx context.Context, session *Session, urls []string, analyzer analytics.Analyzer) []scrapeTarget {
+	onDone := func(h *JobHandle) {
+		session.jobs.remove(h)
+		s.jobFinished(scrapeTarget{url: h.url, handle: h, session: session})
+	}
+	targets := make([]scrapeTarget, len(urls))
+	for i, url := range urls {
+		handle := newJobHandle(ctx, s.ctx, s.jobIndex.Add(1)-1, url, analyzer, onDone)
+		s.jobs.add(handle)
+		session.jobs.add(handle)
+		targets[i] = scrapeTarget{
+			url:     url,
+			handle:  handle,
+			session: session,
+		}
+	}
+	return targets
+}
+
+// cancelTargets finishes the jobs of the targets, notifying their analyzers that they won't be executed.
+func cancelTargets(targets []scrapeTarget, err error) {
+	for _, target := range targets {
+		target.handle.finish(JobCancelled, nil, err)
+	}
+}
+
+// cancelAnalyzer notifies the analyzer that none of the times urls will be executed.
+func cancelAnalyzer(analyzer analytics.Analyzer, times int, err error) {
+	if analyzer == nil {
+		return
+	}
+	for i := 0; i < times; i++ {
+		analyzer.Cancel(err)
+	}
+}
+
+// handles returns the job handles of the targets.
+func handles(targets []scrapeTarget) []*JobHandle {
+	result := make([]*JobHandle, len(targets))
+	for i, target := range targets {
+		result[i] = target.handle
+	}
+	return result
 }
 
 // scrape is responsible for performing web scraping for a given target.
-func (s *Scrapper) scrape(ctx context.Context, id uint64, target scrapeTarget) error {
+func (s *Scrapper) scrape(ctx context.Context, id uint64, target scrapeTarget) (*Page, error) {
 	// ctx cancelled, abort the scrape early
 	if err := ctx.Err(); err != nil {
-		target.analyzer.Cancel(ctx.Err())
-		return err
+		return nil, err
 	}
 
-	page, err := fetchPage(ctx, target.url, http.DefaultClient)
+	page, err := fetchPage(ctx, target.url, target.session.headers, s.client)
 	if err != nil {
-		target.analyzer.Cancel(err)
-		return err
+		return nil, err
 	}
-	s.logger.Debug("fetched page", "jobId", id, "url", target.url, "size", len(page))
-	target.analyzer.Analyze(page)
-	return nil
+	s.logger.Debug("fetched page", "jobId", id, "url", target.url, "size", len(page.Body))
+	return page, nil
 }
 
-// fetchPage fetches the content of a web page.
-func fetchPage(ctx context.Context, url string, client *http.Client) (string, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// fetchPage fetches the content of a web page, sending the headers along with the request.
+func fetchPage(ctx context.Context, url string, headers http.Header, client *http.Client) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	ts := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return &Page{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(body),
+		FetchedAt:  ts,
+		Duration:   time.Since(ts),
+	}, nil
+}
+
+// fetchFailure returns the error the fetch failed with: the transport error, or ErrRetryableStatus if the page was answered
+// with a 5xx or 429 status. Returns nil if the fetch succeeded.
+func fetchFailure(page *Page, err error) error {
+	if err != nil {
+		return err
 	}
-	return string(body), nil
+	if page.StatusCode >= http.StatusInternalServerError || page.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w %d", ErrRetryableStatus, page.StatusCode)
+	}
+	return nil
 }
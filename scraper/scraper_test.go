@@ -1,6 +1,8 @@
 package scraper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
@@ -204,3 +206,196 @@ func TestScrape(t *testing.T) {
 		wg.Wait()
 	})
 }
+
+// TestScrapeSync checks that the synchronous scrape returns the page and respects the caller ctx.
+func TestScrapeSync(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("foo"))
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	page, err := scrapper.ScrapeSync(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Body != "foo" || page.StatusCode != http.StatusOK || page.URL != server.URL {
+		t.Fatalf("unexpected page. got %+v", page)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := scrapper.ScrapeSync(ctx, server.URL+"/slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error. got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestScrapeWithdraw checks that cancelling the submission ctx withdraws the queued target and cancels its analyzer.
+func TestScrapeWithdraw(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+	defer close(release)
+
+	// occupy the only worker
+	if _, err := scrapper.ScrapeContext(nil, server.URL+"/busy", nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	analyzer := &testingCallbackAnalyzer{callback: wg.Done}
+	handle, err := scrapper.ScrapeContext(ctx, server.URL+"/withdrawn", analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	wg.Wait()
+	if !errors.Is(analyzer.err, context.Canceled) || handle.Status() != JobCancelled {
+		t.Fatalf("target not withdrawn. status %v, analyzer err %v", handle.Status(), analyzer.err)
+	}
+}
+
+// TestSetThreads checks that the number of threads can be changed while the scrapper is running.
+func TestSetThreads(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		inFlight int
+		peak     int
+		release  = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	scrapper.SetThreads(3)
+	handles, err := scrapper.ScrapeMulti([]string{server.URL + "/1", server.URL + "/2", server.URL + "/3"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		current := peak
+		mu.Unlock()
+		if current == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("workers not added. peak concurrency %v", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// surplus workers retire after their current scrape
+	scrapper.SetThreads(1)
+	close(release)
+	for _, handle := range handles {
+		if err := handle.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for scrapper.Stats().Workers != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("workers not retired. got %+v", scrapper.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if scrapper.Threads() != 1 {
+		t.Fatalf("unexpected threads. got %v, want %v", scrapper.Threads(), 1)
+	}
+}
+
+// TestDrain checks that draining rejects new targets but finishes the queued ones before stopping.
+func TestDrain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(1)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := scrapper.WaitIdle(ctx); err != nil {
+		t.Fatal("fresh scrapper not idle", err)
+	}
+
+	// single worker, so some of them have to wait for retry
+	handles, err := scrapper.ScrapeMultiContext(ctx, []string{server.URL + "/1", server.URL + "/2", server.URL + "/3"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drained := make(chan error)
+	go func() { drained <- scrapper.Drain(ctx) }()
+	for !scrapper.draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := scrapper.ScrapeContext(ctx, server.URL+"/4", nil); !errors.Is(err, ErrDraining) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrDraining)
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	for _, handle := range handles {
+		if handle.Status() != JobDone {
+			t.Fatalf("queued target not finished. got %v", handle.Status())
+		}
+	}
+}
+
+// TestPriority checks that the pending targets are scraped best-first.
+func TestPriority(t *testing.T) {
+	paths := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer server.Close()
+
+	priorities := map[string]float64{server.URL + "/low": 0.1, server.URL + "/high": 0.9, server.URL + "/mid": 0.5}
+	scrapper := NewScrapper(nil).WithThreads(1).WithPriority(func(url string) float64 { return priorities[url] })
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	// submitted together, so that they are ordered before the only worker takes the first one
+	if _, err := scrapper.ScrapeMulti([]string{server.URL + "/low", server.URL + "/mid", server.URL + "/high"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case path := <-paths:
+		if path != "/high" {
+			t.Fatalf("unexpected first scrape %v", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing scraped")
+	}
+}
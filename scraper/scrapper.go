@@ -2,18 +2,29 @@ package scraper
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/Exca-DK/webscraper/log"
 	"github.com/Exca-DK/webscraper/scraper/analytics"
+	"github.com/Exca-DK/webscraper/scraper/change"
 	"github.com/Exca-DK/webscraper/scraper/prims"
 	"github.com/Exca-DK/webscraper/workers"
 )
 
+var (
+	// ErrQueueFull is returned by TryScrape when the backlog has no space for the targets.
+	ErrQueueFull = errors.New("scrape queue is full")
+	// ErrDraining is returned by scrape submissions once the scrapper is draining.
+	ErrDraining = errors.New("scrapper is draining")
+)
+
 // Scrapper is a web scraping tool designed to fetch, analyze, and navigate web content.
 // It provides the capability to configure the number of threads
 // Scrapes are done in parallel untill the thread limit is hit
@@ -22,25 +33,68 @@ type Scrapper struct {
 	ctx    context.Context
 	cancel func()
 	done   chan struct{} // Channel for stop sig of scrapper
+	// Closed once all of the pool workers have finished
+	poolDone chan struct{}
+	started  atomic.Bool
+	draining atomic.Bool // new targets are rejected
 
 	targetsCh chan []scrapeTarget // Channel for receving new urls to scrape
-	jobCh     chan job            // Channel for executing scrapping
+	refetchCh chan scrapeTarget   // Channel for receiving failed targets that should be fetched again
+	jobCh     chan job            // Channel for executing scrapping, holding one job for the next free worker
+	released  chan struct{}       // Channel waking up the eventLoop once a worker or host slot is released
 
-	// Duration after which the scraper can rescape known websites.
-	// If not set then the scraper will ignore already seen websites for it's whole lifetime.
-	evictionRate time.Duration
-	threads      int // How many threads for execution
+	// Targets accepted but not yet handed over to workers, including the ones waiting for retry.
+	backlog  *backlog
+	retrying atomic.Int64 // amount of targets waiting in the retry queue
 
-	// How many scrapes done, each new scrape job increments this jobIndex
+	threadsMu   sync.Mutex // mutex protecting threads and workerIndex
+	threads     int        // How many threads for execution
+	workerIndex int        // How many workers were created, used for naming them
+
+	// How many scrapes requested, each new scrape job increments this jobIndex
 	jobIndex atomic.Uint64
+	jobs     *jobRegistry      // unfinished jobs
+	results  *resultStream     // stream of finished jobs, nil if not enabled
+	events   *eventBus         // lifecycle events delivered to the observers
 	pool     *workers.WorkPool // Pool managing jobs
 
 	// jobs that are running or yet to launch
-	// required in order to not scrape two same urls concurrently
-	activeMu sync.Mutex
-	active   map[string]struct{}
+	// required in order to not scrape two same urls of a session concurrently
+	activeMu    sync.Mutex
+	active      map[activeKey]struct{}
+	interrupted map[activeKey]struct{} // jobs cancelled by Stop in the middle of their fetch, saved in the state as in-flight
+
+	// Session of the targets submitted through the scrapper itself, its seen urls are the ones saved in the state.
+	session *Session
+
+	hosts    *hostLimiter        // limits concurrent scrapes per host
+	adaptive *adaptiveController // adjusts concurrency based on the fetches, nil if not enabled
+
+	wg sync.WaitGroup // running scrapper threads (eventLoop)
+
+	client      *http.Client    // client of the fetches, bounded by the fetch timeout
+	maxAttempts int             // how many times a target is fetched before it fails permanently
+	deadLetters DeadLetterStore // permanently failed targets
+
+	changes *change.Detector // detects changes of the fetched pages, nil if not enabled
 
-	wg sync.WaitGroup // running scrapper threads (eventLoop + jobs)
+	priority   func(url string) float64 // orders the pending targets of each host best-first, nil keeps the arrival order
+	hostWeight func(host string) int    // targets of the host served per turn, nil serves one target of every host
+	robots     RobotsConfig             // page directives honored by the scrapper
+	traps      *trapDetector            // detects crawler traps, nil if not enabled
+	breakers   *breakers                // circuit breakers of the hosts, nil if not enabled
+
+	contentDedup   bool                 // pages are deduplicated by their content
+	nearDuplicates *NearDuplicateConfig // detection of near-duplicate pages, nil if not enabled
+
+	refreshMu  sync.Mutex     // mutex protecting refreshing
+	refreshing []*Session     // sessions in the refresh mode
+	refreshed  []scrapeTarget // targets scheduled for refresh, accessed only by the eventLoop
+
+	// Store for periodical checkpoints of the crawl state. Checkpoints are disabled if not set.
+	stateStore     StateStore
+	checkpointRate time.Duration
+	resume         *resumeState // state to continue from, consumed by the eventLoop
 
 	logger log.Logger
 }
@@ -50,39 +104,68 @@ func NewScrapper(logger log.Logger) *Scrapper {
 		logger = log.NewLogger(log.Info, os.Stdout)
 	}
 	ch := make(chan workers.JobStats)
+	poolDone := make(chan struct{})
 	go func() {
 		for range ch {
 		}
+		close(poolDone)
 	}()
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Scrapper{
-		ctx:       ctx,
-		cancel:    cancel,
-		done:      make(chan struct{}),
-		targetsCh: make(chan []scrapeTarget),
-		jobCh:     make(chan job),
-		pool:      workers.NewWorkPool(ch),
-		active:    make(map[string]struct{}),
-		logger:    logger,
+	s := &Scrapper{
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		poolDone:    poolDone,
+		targetsCh:   make(chan []scrapeTarget),
+		refetchCh:   make(chan scrapeTarget),
+		released:    make(chan struct{}, 1),
+		jobCh:       make(chan job, 1),
+		backlog:     newBacklog(0),
+		jobs:        newJobRegistry(),
+		events:      newEventBus(),
+		pool:        workers.NewWorkPool(ch),
+		active:      make(map[activeKey]struct{}),
+		interrupted: make(map[activeKey]struct{}),
+		hosts:       newHostLimiter(0),
+		logger:      logger,
+
+		client:      &http.Client{Timeout: DefaultFetchTimeout},
+		maxAttempts: 1,
+		deadLetters: NewMemoryDeadLetterStore(),
 	}
+	s.session = s.NewSession(SessionConfig{Name: "default"})
+	return s
 }
 
 // Start begins the web scraping process by configuring the worker pool, starting it with the specified
 // number of threads, and launching worker threads. The method also initiates the event loop to manage
 // the scraping tasks.
 func (s *Scrapper) Start() {
+	s.threadsMu.Lock()
+	if s.adaptive != nil {
+		s.boundConcurrency(s.adaptive.cfg)
+	}
 	s.pool = s.pool.WithThreads(uint32(s.threads)) // one thread per job
 	s.pool.Start(s.ctx)
-	for i := 0; i < s.threads; i++ {
-		// create a worker that pulls new tasks all the time
+	s.addWorkers(s.threads)
+	s.started.Store(true)
+	s.threadsMu.Unlock()
+	s.wg.Add(1)
+	go s.eventLoop()
+	if s.adaptive != nil {
+		go s.adaptive.run(s.done)
+	}
+}
+
+// addWorkers adds workers that pull new tasks all the time to the pool.
+// Must be called with threadsMu held.
+func (s *Scrapper) addWorkers(num int) {
+	for i := 0; i < num; i++ {
 		s.logger.Debug("adding new worker")
-		worker := workers.NewWorker(workers.NewJob(fmt.Sprintf("scrape-%v", i), s.taskLoop))
-		// add worker
+		worker := workers.NewWorker(workers.NewJob(fmt.Sprintf("scrape-%v", s.workerIndex), s.taskLoop))
+		s.workerIndex++
 		s.pool.AddWorker(worker)
-		s.wg.Add(1)
 	}
-	s.wg.Add(1)
-	go s.eventLoop()
 }
 
 // Stop gracefully terminates the web scraping process.
@@ -93,48 +176,487 @@ func (s *Scrapper) Stop() {
 		s.cancel()
 		close(s.done)
 		s.wg.Wait()
+		if s.started.Load() {
+			<-s.poolDone
+		}
+		// otherwise closed by the last finishing job
+		if s.jobs.len() == 0 {
+			s.closeStreams()
+		}
 	}
 }
 
+// WaitIdle waits until there are no targets queued, in flight or awaiting retry.
+// It returns right away if the scrapper is idle, and with the ctx error if ctx is done first.
+// Targets submitted while analyzing a page are queued before that page is finished,
+// so the scrapper becomes idle only once the whole link graph is exhausted.
+func (s *Scrapper) WaitIdle(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.jobs.idleCh():
+		return nil
+	}
+}
+
+// Drain stops accepting new targets, waits for the queued ones and their retries to finish and then stops the scrapper.
+// If ctx is done first, the scrapper is stopped right away, cancelling the remaining targets, and the ctx error is returned.
+func (s *Scrapper) Drain(ctx context.Context) error {
+	s.draining.Store(true)
+	s.logger.Debug("draining scrapper", "jobs:", s.jobs.len())
+	err := s.WaitIdle(ctx)
+	s.Stop()
+	return err
+}
+
 // WithThreads configures the number of worker threads to use for web scraping tasks.
+// Use SetThreads to change it after Start.
 func (s *Scrapper) WithThreads(num int) *Scrapper {
+	s.threadsMu.Lock()
 	s.threads = num
+	s.threadsMu.Unlock()
 	return s
 }
 
+// SetThreads changes the number of worker threads while the scrapper is running.
+// New workers are started right away, while surplus workers stop after finishing their current scrape.
+func (s *Scrapper) SetThreads(num int) {
+	if num < 1 {
+		num = 1
+	}
+	s.threadsMu.Lock()
+	defer s.threadsMu.Unlock()
+	previous := s.threads
+	s.threads = num
+	if !s.started.Load() {
+		return
+	}
+	s.addWorkers(s.pool.Resize(uint32(num)))
+	s.logger.Info("changed scrapper threads", "from:", previous, "to:", num)
+}
+
+// Threads returns the configured number of worker threads.
+func (s *Scrapper) Threads() int {
+	s.threadsMu.Lock()
+	defer s.threadsMu.Unlock()
+	return s.threads
+}
+
 // WithEviction configures the eviction rate for the worker pool, determining how frequently old entries can be rescaped.
 // Default value of 0 means that scraper will not try to retry old entry ever.
 func (s *Scrapper) WithEviction(duration time.Duration) *Scrapper {
-	s.evictionRate = duration
+	s.session.eviction = duration
 	return s
 }
 
-// Scrape add's url to scrapper queue.
-func (s *Scrapper) Scrape(url string, analyzer analytics.Analyzer) {
-	s.requestScrape([]scrapeTarget{{url: url, analyzer: analyzer}})
+// WithHostConcurrency configures the maximum amount of concurrent scrapes of a single host.
+// Targets of a host that is at its limit wait for retry. Default value of 0 means unlimited.
+// It must be called before Start.
+func (s *Scrapper) WithHostConcurrency(limit int) *Scrapper {
+	s.hosts = newHostLimiter(limit)
+	return s
 }
 
-// Scrape add's urls to scrapper queue. The analyzer will be called once for each of the url.
-func (s *Scrapper) ScrapeMulti(urls []string, analyzer analytics.Analyzer) {
-	targets := make([]scrapeTarget, len(urls))
-	for i, url := range urls {
-		targets[i] = scrapeTarget{
-			url:      url,
-			analyzer: analyzer,
-		}
+// WithAdaptiveConcurrency enables the controller adjusting the worker threads and per host limits
+// within the configured bounds, based on the latency, errors and throttling responses of the fetches.
+// The concurrency configured by the other options is brought within the bounds at Start. It must be called before Start.
+func (s *Scrapper) WithAdaptiveConcurrency(cfg AdaptiveConfig) *Scrapper {
+	s.adaptive = newAdaptiveController(cfg, s, s.logger)
+	return s
+}
+
+// boundConcurrency brings the threads and the default host limit within the bounds of the adaptive controller,
+// so that it starts within them. Must be called with threadsMu held.
+func (s *Scrapper) boundConcurrency(cfg AdaptiveConfig) {
+	s.threads = min(max(s.threads, cfg.MinThreads), cfg.MaxThreads)
+	if cfg.MaxHostLimit > 0 {
+		s.hosts.capLimit(cfg.MaxHostLimit)
+	}
+}
+
+// setHostLimit implements adaptiveTarget.
+func (s *Scrapper) setHostLimit(host string, limit int) {
+	s.hosts.setLimit(host, limit)
+}
+
+// hostLimit implements adaptiveTarget.
+func (s *Scrapper) hostLimit(host string) int {
+	return s.hosts.getLimit(host)
+}
+
+// WithBudget configures the budget of the crawl submitted through the scrapper, sessions have their own budgets.
+// Once any of its limits is exceeded, the remaining targets are cancelled with ErrBudgetExceeded. It must be called before Start.
+func (s *Scrapper) WithBudget(b Budget) *Scrapper {
+	s.session.budget.crawl = b
+	return s
+}
+
+// WithHostBudget configures the budget applied to every host separately. Once any of its limits is exceeded,
+// the remaining targets of the host are cancelled with ErrBudgetExceeded. It must be called before Start.
+func (s *Scrapper) WithHostBudget(b Budget) *Scrapper {
+	s.session.budget.host = b
+	return s
+}
+
+// BudgetReport returns the current consumption of the crawl budget and the budgets of every host.
+func (s *Scrapper) BudgetReport() BudgetReport {
+	return s.session.budget.report()
+}
+
+// WithMaxBacklog configures the maximum amount of targets waiting for execution, including the ones waiting for retry,
+// and of the results waiting for the consumer of the results channel.
+// Scrape blocks and TryScrape fails once the limit is reached. Default value of 0 means that the backlog is unbounded.
+// It must be called before Start.
+func (s *Scrapper) WithMaxBacklog(limit int) *Scrapper {
+	if limit < 0 {
+		limit = 0
+	}
+	s.backlog = newBacklog(limit)
+	if s.results != nil {
+		s.results.backlog = s.backlog
+	}
+	return s
+}
+
+// WithResults enables the stream of results, delivering exactly one result for every submitted job.
+// The buffer configures the capacity of the results channel. Results that don't fit are held by the scrapper
+// without blocking the workers, taking up the backlog until they are consumed, so a slow consumer makes Scrape
+// wait for capacity as the backlog configured by WithMaxBacklog fills up. With the unbounded backlog the held results
+// aren't limited. It must be called before Start.
+func (s *Scrapper) WithResults(buffer int) *Scrapper {
+	s.results = newResultStream(buffer, s.backlog)
+	return s
+}
+
+// WithStateStore configures the store used for checkpointing the crawl state.
+// The state is saved every interval and once more when the scrapper stops.
+// Interval of 0 means that the state is saved only when the scrapper stops.
+func (s *Scrapper) WithStateStore(store StateStore, interval time.Duration) *Scrapper {
+	s.stateStore = store
+	s.checkpointRate = interval
+	return s
+}
+
+// Resume configures the scrapper to continue from the snapshot. It must be called before Start.
+// The seen urls are restored together with their eviction deadlines, while the pending and in-flight
+// urls are queued again with analyzers created by the factory.
+func (s *Scrapper) Resume(snapshot Snapshot, factory func(url string) analytics.Analyzer) *Scrapper {
+	s.resume = &resumeState{snapshot: snapshot, factory: factory}
+	return s
+}
+
+// Stats represents the current load of the scrapper.
+type Stats struct {
+	Backlog  int // targets waiting for execution, including the ones waiting for retry, and results waiting for the consumer
+	Retrying int // targets waiting for retry, including the ones parked by open circuit breakers
+	InFlight int // targets being scraped right now
+	Capacity int // maximum backlog, 0 if unbounded
+	Threads  int // configured worker threads
+	Workers  int // running workers, including the ones finishing their last scrape before retiring
+
+	Breakers map[string]BreakerState // hosts whose circuit breaker isn't closed, nil if breakers aren't enabled
+}
+
+// Stats returns the current load of the scrapper.
+func (s *Scrapper) Stats() Stats {
+	s.activeMu.Lock()
+	inFlight := len(s.active)
+	s.activeMu.Unlock()
+	return Stats{
+		Backlog:  s.backlog.len(),
+		Retrying: int(s.retrying.Load()),
+		InFlight: inFlight,
+		Capacity: s.backlog.limit,
+		Threads:  s.Threads(),
+		Workers:  s.pool.RunningWorkers(),
+		Breakers: s.breakerStates(),
 	}
-	s.requestScrape(targets)
 }
 
-// requestScrape tries to add the targets to the queue.
-func (s *Scrapper) requestScrape(targets []scrapeTarget) {
+// Results returns the channel delivering the result of every finished job.
+// Undelivered results take up the backlog, see WithResults, so the channel must be consumed for the scraping to go on.
+// The channel is closed once the scrapper is stopped and all of the results are delivered.
+// Returns nil if the results were not enabled by WithResults.
+func (s *Scrapper) Results() <-chan Result {
+	if s.results == nil {
+		return nil
+	}
+	return s.results.out
+}
+
+// ResultIterator returns an iterator over the results channel.
+func (s *Scrapper) ResultIterator() *ResultIterator {
+	return &ResultIterator{ch: s.Results()}
+}
+
+// jobFinished is called exactly once for every job when it finishes.
+func (s *Scrapper) jobFinished(target scrapeTarget) {
+	if target.handle.Status() == JobFailed {
+		s.deadLetter(target)
+	}
+	// publish before removal, so that the streams aren't closed in the meantime
+	if kind, event, ok := finishedEvent(target); ok {
+		s.events.emit(kind, event)
+	}
+	if s.results != nil {
+		s.results.publish(target.handle.result())
+	}
+	s.jobs.remove(target.handle)
 	select {
 	case <-s.done:
-		// notify analyzer that it won't be executed if scrapper is already stopped.
-		for _, target := range targets {
-			target.analyzer.Cancel(s.ctx.Err())
+		// stopped, the last job closes the streams
+		if s.jobs.len() == 0 {
+			s.closeStreams()
+		}
+	default:
+	}
+}
+
+// closeStreams closes the streams of results and events once the scrapper is stopped and all jobs are finished.
+func (s *Scrapper) closeStreams() {
+	if s.results != nil {
+		s.results.close()
+	}
+	s.events.close()
+}
+
+// WithObserver registers the observer of the job lifecycle events.
+func (s *Scrapper) WithObserver(o Observer) *Scrapper {
+	s.events.add(o)
+	return s
+}
+
+// Jobs returns description of all unfinished jobs ordered by their id.
+func (s *Scrapper) Jobs() []JobInfo {
+	return s.jobs.list()
+}
+
+// ScrapeSync scrapes the url and returns the page. It goes through the same queue as Scrape,
+// with ctx bounding both the wait for space in the backlog and the scrape itself.
+func (s *Scrapper) ScrapeSync(ctx context.Context, url string) (*Page, error) {
+	handle, err := s.ScrapeContext(ctx, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the job is withdrawn once ctx is done, so it always finishes
+	<-handle.Done()
+	return handle.Page(), handle.Err()
+}
+
+// Scrape add's url to scrapper queue and returns the handle of the scrape job. It blocks until there is space in the backlog.
+// If the scrapper is stopped before that, the analyzer is cancelled and the error is returned. Nil analyzer is allowed.
+// The signature is kept without a context for the existing callers, use ScrapeContext to bound the wait.
+func (s *Scrapper) Scrape(url string, analyzer analytics.Analyzer) (*JobHandle, error) {
+	return s.ScrapeContext(context.Background(), url, analyzer)
+}
+
+// ScrapeContext is like Scrape, but ctx also bounds the wait for space in the backlog.
+// Once queued, the job is cancelled when ctx is done. Nil ctx never gets done.
+func (s *Scrapper) ScrapeContext(ctx context.Context, url string, analyzer analytics.Analyzer) (*JobHandle, error) {
+	handles, err := s.ScrapeMultiContext(ctx, []string{url}, analyzer)
+	if err != nil {
+		return nil, err
+	}
+	return handles[0], nil
+}
+
+// ScrapeMulti add's urls to scrapper queue and returns the handles of scrape jobs in the order of urls.
+// The analyzer will be called once for each of the url.
+// It blocks until there is space in the backlog for all of the urls.
+// If the scrapper is stopped before that, the analyzer is cancelled for every url.
+func (s *Scrapper) ScrapeMulti(urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	return s.ScrapeMultiContext(context.Background(), urls, analyzer)
+}
+
+// ScrapeMultiContext is like ScrapeMulti, but ctx also bounds the wait for space in the backlog.
+// If ctx is done before that, the analyzer is cancelled for every url.
+// Once queued, the jobs are cancelled when ctx is done. Nil ctx never gets done.
+func (s *Scrapper) ScrapeMultiContext(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	return s.scrapeMulti(ctx, s.session, urls, analyzer, false)
+}
+
+// scrapeMulti add's urls of the session to scrapper queue, see ScrapeMultiContext.
+// Revisited urls are scraped even if they were already seen by the session.
+func (s *Scrapper) scrapeMulti(ctx context.Context, session *Session, urls []string, analyzer analytics.Analyzer, revisit bool) ([]*JobHandle, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if s.draining.Load() {
+		cancelAnalyzer(analyzer, len(urls), ErrDraining)
+		return nil, ErrDraining
+	}
+	targets, err := session.register(ctx, urls, analyzer)
+	if err != nil {
+		cancelAnalyzer(analyzer, len(urls), err)
+		return nil, err
+	}
+	for i := range targets {
+		targets[i].revisit = revisit
+	}
+	for pending := targets; len(pending) > 0; {
+		// queue in chunks, so that requests bigger than the backlog can be queued as well
+		chunk := pending[:s.backlog.chunk(len(pending))]
+		if err := s.backlog.reserve(ctx, s.ctx, len(chunk)); err != nil {
+			cancelTargets(pending, err)
+			return nil, err
+		}
+		if err := s.requestScrape(ctx, chunk); err != nil {
+			cancelTargets(pending, err)
+			return nil, err
+		}
+		pending = pending[len(chunk):]
+	}
+	return handles(targets), nil
+}
+
+// WithMaxAttempts configures how many times a target is fetched before it fails permanently.
+// Failed fetches wait for the retry like the targets that found no free worker. Default value is 1, no retries.
+func (s *Scrapper) WithMaxAttempts(attempts int) *Scrapper {
+	if attempts < 1 {
+		attempts = 1
+	}
+	s.maxAttempts = attempts
+	return s
+}
+
+// WithFetchTimeout configures how long a single fetch may take, including the read of the body.
+// Fetches that time out are failed attempts. Default value is DefaultFetchTimeout.
+func (s *Scrapper) WithFetchTimeout(timeout time.Duration) *Scrapper {
+	s.client = &http.Client{Timeout: timeout}
+	return s
+}
+
+// WithHostWeight sets how many targets of the host are handed over to the workers per turn.
+// Hosts take turns in round robin, by default serving one target each, so that hosts with many targets
+// don't hold back the others.
+func (s *Scrapper) WithHostWeight(weight func(host string) int) *Scrapper {
+	s.hostWeight = weight
+	return s
+}
+
+// WithPriority orders the pending targets of each host by the priority of their urls, highest first, eg. by their PageRank.
+// Targets with equal priority keep their arrival order. The order doesn't override the fairness: hosts still take their turns
+// round-robin, as do the sessions within the turn of a host, so a lower priority target of one host is fetched before
+// the higher priority targets of the hosts waiting for their turn. The priority is called from the scheduling loop, so it must be fast.
+func (s *Scrapper) WithPriority(priority func(url string) float64) *Scrapper {
+	s.priority = priority
+	return s
+}
+
+// prioritize sorts the targets by their priority, highest first.
+func (s *Scrapper) prioritize(targets []scrapeTarget) {
+	if s.priority == nil || len(targets) < 2 {
+		return
+	}
+	priorities := make(map[string]float64, len(targets))
+	for _, target := range targets {
+		if _, ok := priorities[target.url]; !ok {
+			priorities[target.url] = s.priority(target.url)
 		}
+	}
+	sort.SliceStable(targets, func(i, j int) bool { return priorities[targets[i].url] > priorities[targets[j].url] })
+}
+
+// WithChangeDetector enables detection of changes of the fetched pages between their scrapes.
+// Detected changes are reported to the observers by OnChanged.
+func (s *Scrapper) WithChangeDetector(d *change.Detector) *Scrapper {
+	s.changes = d
+	return s
+}
+
+// WithDeadLetters configures the store of permanently failed targets. By default they are kept in memory.
+func (s *Scrapper) WithDeadLetters(store DeadLetterStore) *Scrapper {
+	s.deadLetters = store
+	return s
+}
+
+// DeadLetters returns the permanently failed targets.
+func (s *Scrapper) DeadLetters() ([]DeadLetter, error) {
+	return s.deadLetters.List()
+}
+
+// ResubmitDeadLetters removes the urls from the dead letters and scrapes them again, even though they were already seen.
+// It behaves like ScrapeMulti otherwise.
+func (s *Scrapper) ResubmitDeadLetters(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	if err := s.deadLetters.Remove(urls...); err != nil {
+		cancelAnalyzer(analyzer, len(urls), err)
+		return nil, err
+	}
+	return s.Rescrape(ctx, urls, analyzer)
+}
+
+// Rescrape add's urls to scrapper queue like ScrapeMulti, but scrapes them even if they were already seen.
+func (s *Scrapper) Rescrape(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	return s.scrapeMulti(ctx, s.session, urls, analyzer, true)
+}
+
+// deadLetter records the permanently failed target.
+func (s *Scrapper) deadLetter(target scrapeTarget) {
+	info, result := target.handle.Info(), target.handle.result()
+	letter := DeadLetter{
+		URL:       target.url,
+		Session:   target.session.name,
+		Err:       result.Err.Error(),
+		Attempts:  info.Attempts,
+		CreatedAt: info.CreatedAt,
+		FailedAt:  time.Now(),
+	}
+	if err := s.deadLetters.Add(letter); err != nil {
+		s.logger.Warn("failed saving dead letter", "url:", target.url, "err:", err.Error())
+	}
+}
+
+// refetch hands the failed target back to the event loop for another attempt.
+// The target is cancelled if the scrapper stops in the meantime.
+func (s *Scrapper) refetch(target scrapeTarget) {
+	target.revisit = true
+	select {
+	case s.refetchCh <- target:
+	case <-s.done:
+		target.handle.finish(JobCancelled, nil, s.ctx.Err())
+	}
+}
+
+// TryScrape add's url to scrapper queue only if there is space in the backlog and returns the handle of the scrape job.
+// Otherwise ErrQueueFull, or ErrDraining if the scrapper is draining, is returned and the analyzer is not called.
+func (s *Scrapper) TryScrape(url string, analyzer analytics.Analyzer) (*JobHandle, error) {
+	handles, err := s.TryScrapeMulti([]string{url}, analyzer)
+	if err != nil {
+		return nil, err
+	}
+	return handles[0], nil
+}
+
+// TryScrapeMulti add's urls to scrapper queue only if there is space in the backlog for all of them
+// and returns the handles of scrape jobs in the order of urls.
+// Otherwise ErrQueueFull, or ErrDraining if the scrapper is draining, is returned and the analyzer is not called.
+func (s *Scrapper) TryScrapeMulti(urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	if s.draining.Load() {
+		return nil, ErrDraining
+	}
+	if !s.backlog.tryReserve(len(urls)) {
+		return nil, ErrQueueFull
+	}
+	targets := s.newTargets(context.Background(), s.session, urls, analyzer)
+	if err := s.requestScrape(context.Background(), targets); err != nil {
+		cancelTargets(targets, err)
+		return nil, err
+	}
+	return handles(targets), nil
+}
+
+// requestScrape tries to add the targets, which have already reserved space in the backlog, to the queue.
+// On failure the reservation is released.
+func (s *Scrapper) requestScrape(ctx context.Context, targets []scrapeTarget) error {
+	select {
+	case <-s.done:
+		s.backlog.release(len(targets))
+		return s.ctx.Err()
+	case <-ctx.Done():
+		s.backlog.release(len(targets))
+		return ctx.Err()
 	case s.targetsCh <- targets:
+		return nil
 	}
 }
 
@@ -146,84 +668,233 @@ func (s *Scrapper) eventLoop() {
 	defer ticker.Stop()
 
 	retryQueue := make(prims.Queue[scrapeTarget], 0)
-	cache := prims.NewSimpleEvictableCache[string, struct{}](func(_ string, _ struct{}) {})
+	parked := newParking()
+	var order func([]scrapeTarget)
+	if s.priority != nil {
+		order = s.prioritize
+	}
+	pending := newFrontier(s.hostWeight, order)
 
 	var targets []scrapeTarget
+	if s.resume != nil {
+		targets = s.restore(s.resume)
+		s.emitQueued(targets)
+		s.backlog.add(len(targets))
+		s.resume = nil
+	}
+
+	var checkpointCh <-chan time.Time
+	if s.stateStore != nil && s.checkpointRate > 0 {
+		checkpointTicker := time.NewTicker(s.checkpointRate)
+		defer checkpointTicker.Stop()
+		checkpointCh = checkpointTicker.C
+	}
 OUTER:
 	for {
 		select {
 		case <-s.done:
 			// scrapper stopped
 			break OUTER
+		case <-checkpointCh:
+			s.checkpoint(s.snapshot(append(pending.targets(), parked.targets()...), retryQueue))
 		case req := <-s.targetsCh:
 			s.logger.Debug("added new targets", "targets:", len(req))
 			targets = append(targets, req...)
+			s.emitQueued(req)
+		case target := <-s.refetchCh:
+			// fetch failed, try again later
+			s.backlog.add(1)
+			retryQueue.Push(target)
+			s.events.emit(eventRetryScheduled, newEvent(target))
+		case <-s.released:
+			// worker or host slot released, serve the waiting targets
 		case <-ticker.C:
 			// try to add elems from failed queue
 			for target, ok := retryQueue.Pop(); ok; target, ok = retryQueue.Pop() {
 				targets = append(targets, target)
 			}
+			// hosts whose breakers let a probe through
+			if s.breakers != nil {
+				targets = append(targets, parked.unpark(s.breakers.blocked)...)
+			}
+			s.evictRefreshing()
+			// priorities may have changed in the meantime
+			pending.reorder()
 		}
 
-		for _, target := range targets {
-			// if already in cache, ignore.
-			if cache.Seen(target.url) {
-				continue
+		// urls due for refresh
+		if len(s.refreshed) > 0 {
+			s.backlog.add(len(s.refreshed))
+			s.emitQueued(s.refreshed)
+			targets = append(targets, s.refreshed...)
+			s.refreshed = nil
+		}
+
+		// fair between hosts and between sessions within each host, best-first if prioritized
+		pending.push(targets)
+		// clear
+		targets = targets[len(targets):]
+
+		released := 0
+		pending.serve(func(target scrapeTarget) dispatchOutcome {
+			// withdrawn by the caller, nothing to do
+			if target.handle.finished() {
+				released++
+				return removed
+			}
+			// not part of the session, drop.
+			if !target.session.inScope(target.url) {
+				target.handle.finish(JobDropped, nil, ErrOutOfScope)
+				released++
+				return removed
+			}
+			// if already seen by the session, drop.
+			if !target.revisit && target.session.seen.Seen(target.url) {
+				target.handle.finish(JobDropped, nil, ErrDuplicate)
+				released++
+				return removed
+			}
+			// looks like a crawler trap, drop
+			if err := s.checkTrap(target); err != nil {
+				target.handle.finish(JobDropped, nil, err)
+				released++
+				return removed
 			}
-			// not interested at all. ignore
+			// being scraped right now, drop
 			if !s.canQueueTarget(target) {
-				continue
+				target.handle.finish(JobDropped, nil, ErrDuplicate)
+				released++
+				// keep refreshing the url, which is due for refresh before its scrape finished
+				if target.session.refresh != nil {
+					target.session.seen.AddIfNotSeen(target.url, struct{}{}, target.session.deadline(target.url))
+				}
+				return removed
+			}
+			host := HostOf(target.url)
+			// crawl or host budget exhausted, cancel
+			if err := target.session.budget.check(host); err != nil {
+				s.deactivate(target)
+				target.handle.finish(JobCancelled, nil, err)
+				released++
+				return removed
+			}
+			// host is at its limit, serve the other hosts
+			if !s.hosts.acquire(host) {
+				s.deactivate(target)
+				return blocked
+			}
+			// breaker of the host is open, park until it lets a probe through.
+			// Targets parked again, eg. behind the probe, are already waiting for retry.
+			if !s.allowHost(target, host) {
+				if target.handle.retry() {
+					s.events.emit(eventRetryScheduled, newEvent(target))
+				}
+				parked.park(host, target)
+				s.hosts.release(host)
+				s.deactivate(target)
+				return removed
 			}
 			if !s.tryQueueTarget(target, func() {
 				// clear pending from job thread
-				s.activeMu.Lock()
-				delete(s.active, target.url)
-				s.activeMu.Unlock()
+				s.hosts.release(host)
+				s.deactivate(target)
+				s.release()
 			}) {
-
-				// add to retry and remove from active on failure
-				retryQueue.Push(target)
-				s.activeMu.Lock()
-				delete(s.active, target.url)
-				s.activeMu.Unlock()
-				continue
+				// all of the workers are busy, wait for one of them
+				s.hosts.release(host)
+				s.deactivate(target)
+				return stopped
 			}
-
-			// only add to cache when job has been succesfully accepted by worker.
-			var deadline time.Time
-			if s.evictionRate != 0 {
-				deadline = time.Now().Add(s.evictionRate)
+			// released from the backlog once a worker takes it
+			target.session.budget.admit(host)
+			if s.traps != nil && !target.revisit {
+				s.traps.admit(target.url)
 			}
-			cache.AddIfNotSeen(target.url, struct{}{}, deadline)
-		}
-		// clear
-		targets = targets[len(targets):]
+
+			// only add to seen when job has been succesfully accepted by worker.
+			target.session.seen.AddIfNotSeen(target.url, struct{}{}, target.session.deadline(target.url))
+			return dispatched
+		})
+		s.retrying.Store(int64(len(retryQueue) + parked.len()))
+		s.backlog.release(released)
+	}
+
+	// persist what is left before the pending analyzers are cancelled
+	if s.stateStore != nil {
+		s.checkpoint(s.snapshot(append(append(pending.targets(), targets...), parked.targets()...), retryQueue))
+	}
+
+	// job left for the next free worker, which is stopping as well
+	select {
+	case j := <-s.jobCh:
+		j.target.handle.finish(JobCancelled, nil, s.ctx.Err())
+		j.callback()
+		s.backlog.release(1)
+	default:
 	}
 
 	// cleanup all of the pending analyzers
-	for _, target := range targets {
-		target.analyzer.Cancel(s.ctx.Err())
+	cancelTargets(targets, s.ctx.Err())
+	cancelTargets(pending.targets(), s.ctx.Err())
+	cancelTargets(retryQueue, s.ctx.Err())
+	cancelTargets(parked.targets(), s.ctx.Err())
+	s.backlog.release(len(targets) + pending.len() + len(retryQueue) + parked.len())
+	s.retrying.Store(0)
+}
+
+// release wakes up the eventLoop, so that it serves the waiting targets once a worker or host slot is released.
+func (s *Scrapper) release() {
+	select {
+	case s.released <- struct{}{}:
+	default:
 	}
+}
 
-	for _, target := range retryQueue {
-		target.analyzer.Cancel(s.ctx.Err())
+// emitQueued emits the queued event of every target.
+func (s *Scrapper) emitQueued(targets []scrapeTarget) {
+	for _, target := range targets {
+		s.events.emit(eventQueued, newEvent(target))
 	}
 }
 
+// activeKey identifies the url being scraped by a session.
+type activeKey struct {
+	session *Session
+	url     string
+}
+
 // canQueueTarget checks if a given scrape target can be added to the scraping process.
 func (s *Scrapper) canQueueTarget(t scrapeTarget) bool {
-	// only unique scans at a time
+	// only unique scans of the session at a time
+	key := activeKey{session: t.session, url: t.url}
 	s.activeMu.Lock()
-	if _, ok := s.active[t.url]; ok {
+	if _, ok := s.active[key]; ok {
 		s.activeMu.Unlock()
 		return false
 	}
-	s.active[t.url] = struct{}{}
+	s.active[key] = struct{}{}
 	s.activeMu.Unlock()
 
 	return true
 }
 
+// deactivate removes the target from the active ones.
+func (s *Scrapper) deactivate(t scrapeTarget) {
+	s.activeMu.Lock()
+	delete(s.active, activeKey{session: t.session, url: t.url})
+	s.activeMu.Unlock()
+}
+
+// interrupt removes the target cancelled by Stop from the active ones, keeping it as interrupted,
+// so that the final checkpoint saves it as in-flight even after its worker gave it up.
+func (s *Scrapper) interrupt(t scrapeTarget) {
+	key := activeKey{session: t.session, url: t.url}
+	s.activeMu.Lock()
+	delete(s.active, key)
+	s.interrupted[key] = struct{}{}
+	s.activeMu.Unlock()
+}
+
 // tryQueueTarget attempts to add a scrape target to the job channel for processing by worker threads.
 func (s *Scrapper) tryQueueTarget(t scrapeTarget, callback func()) bool {
 	j := job{
@@ -239,3 +910,76 @@ func (s *Scrapper) tryQueueTarget(t scrapeTarget, callback func()) bool {
 		return false
 	}
 }
+
+// snapshot captures the current crawl state of the default session in the event loop.
+func (s *Scrapper) snapshot(targets []scrapeTarget, retryQueue prims.Queue[scrapeTarget]) Snapshot {
+	cache := s.session.seen
+	snapshot := Snapshot{
+		SavedAt:  time.Now(),
+		Frontier: make([]string, 0, len(targets)+len(retryQueue)),
+		Seen:     make([]SeenEntry, 0, cache.Len()),
+	}
+	for _, target := range targets {
+		if target.session == s.session {
+			snapshot.Frontier = append(snapshot.Frontier, target.url)
+		}
+	}
+	for _, target := range retryQueue {
+		if target.session == s.session {
+			snapshot.Frontier = append(snapshot.Frontier, target.url)
+		}
+	}
+
+	s.activeMu.Lock()
+	snapshot.InFlight = make([]string, 0, len(s.active)+len(s.interrupted))
+	for key := range s.active {
+		if key.session == s.session {
+			snapshot.InFlight = append(snapshot.InFlight, key.url)
+		}
+	}
+	for key := range s.interrupted {
+		if _, ok := s.active[key]; !ok && key.session == s.session {
+			snapshot.InFlight = append(snapshot.InFlight, key.url)
+		}
+	}
+	s.activeMu.Unlock()
+
+	cache.Range(func(url string, _ struct{}, deadline time.Time) {
+		snapshot.Seen = append(snapshot.Seen, SeenEntry{URL: url, Deadline: deadline})
+	})
+	return snapshot
+}
+
+// checkpoint saves the snapshot in the state store.
+func (s *Scrapper) checkpoint(snapshot Snapshot) {
+	if err := s.stateStore.Save(snapshot); err != nil {
+		s.logger.Warn("failed saving crawl state", "err:", err.Error())
+		return
+	}
+	s.logger.Debug("saved crawl state", "pending:", len(snapshot.Frontier), "inFlight:", len(snapshot.InFlight), "seen:", len(snapshot.Seen))
+}
+
+// restore seeds the default session with seen urls from the resumed snapshot and returns the targets that have to be scraped.
+// Pending urls, in-flight ones as well as the ones waiting for a retry or parked by a breaker, were never finished,
+// so they are scraped again instead of being marked as seen.
+func (s *Scrapper) restore(state *resumeState) []scrapeTarget {
+	cache := s.session.seen
+	pending := state.snapshot.Pending()
+	unfinished := make(map[string]struct{}, len(pending))
+	for _, url := range pending {
+		unfinished[url] = struct{}{}
+	}
+	for _, entry := range state.snapshot.Seen {
+		if _, ok := unfinished[entry.URL]; ok {
+			continue
+		}
+		cache.AddIfNotSeen(entry.URL, struct{}{}, entry.Deadline)
+	}
+
+	targets := make([]scrapeTarget, 0, len(pending))
+	for _, url := range pending {
+		targets = append(targets, s.newTargets(context.Background(), s.session, []string{url}, state.factory(url))...)
+	}
+	s.logger.Info("resumed crawl state", "pending:", len(targets), "seen:", cache.Len(), "savedAt:", state.snapshot.SavedAt)
+	return targets
+}
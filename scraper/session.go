@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+	"github.com/Exca-DK/webscraper/scraper/prims"
+)
+
+var (
+	// ErrOutOfScope is the error of jobs dropped because their url is rejected by the scope of the session.
+	ErrOutOfScope = errors.New("url out of session scope")
+	// ErrSessionClosed is returned by scrape submissions once the session is closed.
+	ErrSessionClosed = errors.New("session is closed")
+)
+
+// SessionConfig configures a crawl session.
+type SessionConfig struct {
+	Name       string
+	Scope      func(url string) bool // reports whether the url belongs to the session, nil accepts every url
+	Headers    http.Header           // headers added to every request of the session
+	Eviction   time.Duration         // duration after which the session can rescrape known urls, 0 means never
+	Budget     Budget                // budget of the whole session
+	HostBudget Budget                // budget applied to every host of the session separately
+	Refresh    *RefreshConfig        // enables the refresh mode, nil disables it
+}
+
+// Session is an isolated crawl running in the scrapper. Every session has its own scope, seen urls,
+// headers, budgets and completion signal, while the workers and per host limits are shared by all of them.
+// The sessions crawling the same host take turns within the turn of the host, so a big session doesn't starve the others there.
+// The fairness is per host only: a session spread over many hosts takes a turn with each of them, getting more of the workers
+// than a session crawling a single host.
+type Session struct {
+	name     string
+	scope    func(url string) bool
+	headers  http.Header
+	eviction time.Duration
+
+	scrapper *Scrapper
+	seen     *prims.SimpleEvictableCache[string, struct{}] // urls handed over to workers, accessed only by the eventLoop
+	budget   *budgetTracker
+	jobs     *jobRegistry // unfinished jobs of the session
+	refresh  *refresher   // refresh intervals of the urls, nil if the refresh mode is disabled
+
+	canonicals   canonicals   // canonical urls of the scraped pages, used only if the scrapper honors them
+	contents     contents     // urls serving the scraped bodies, used only if the scrapper deduplicates the content
+	fingerprints fingerprints // fingerprints of the scraped pages, used only if the scrapper detects near duplicates
+
+	mu     sync.Mutex // mutex protecting closed
+	closed bool
+	done   chan struct{} // closed once the session is closed and all of its jobs are finished
+}
+
+// NewSession creates a new session sharing the workers of the scrapper.
+func (s *Scrapper) NewSession(cfg SessionConfig) *Session {
+	session := &Session{
+		name:     cfg.Name,
+		scope:    cfg.Scope,
+		headers:  cfg.Headers.Clone(),
+		eviction: cfg.Eviction,
+		scrapper: s,
+		budget:   newBudgetTracker(cfg.Budget, cfg.HostBudget),
+		jobs:     newJobRegistry(),
+		done:     make(chan struct{}),
+	}
+	session.seen = prims.NewSimpleEvictableCache[string, struct{}](session.evicted)
+	if cfg.Refresh != nil {
+		session.enableRefresh(*cfg.Refresh)
+	}
+	return session
+}
+
+// Name returns the name of the session.
+func (s *Session) Name() string { return s.name }
+
+// Scrape add's url to the session and returns the handle of the scrape job.
+// It behaves like Scrapper.Scrape, but fails with ErrSessionClosed once the session is closed.
+func (s *Session) Scrape(url string, analyzer analytics.Analyzer) (*JobHandle, error) {
+	return s.ScrapeContext(context.Background(), url, analyzer)
+}
+
+// ScrapeContext is like Scrape, but ctx bounds the wait for space in the backlog and cancels the job, see Scrapper.ScrapeContext.
+func (s *Session) ScrapeContext(ctx context.Context, url string, analyzer analytics.Analyzer) (*JobHandle, error) {
+	handles, err := s.ScrapeMultiContext(ctx, []string{url}, analyzer)
+	if err != nil {
+		return nil, err
+	}
+	return handles[0], nil
+}
+
+// ScrapeMulti add's urls to the session and returns the handles of scrape jobs in the order of urls.
+// It behaves like Scrapper.ScrapeMulti, but fails with ErrSessionClosed once the session is closed.
+func (s *Session) ScrapeMulti(urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	return s.ScrapeMultiContext(context.Background(), urls, analyzer)
+}
+
+// ScrapeMultiContext is like ScrapeMulti, but ctx bounds the wait for space in the backlog and cancels the jobs,
+// see Scrapper.ScrapeMultiContext.
+func (s *Session) ScrapeMultiContext(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]*JobHandle, error) {
+	return s.scrapper.scrapeMulti(ctx, s, urls, analyzer, false)
+}
+
+// Close stops accepting new urls. Already submitted jobs are carried on and Done is closed once all of them finish.
+func (s *Session) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	idle := s.jobs.idleCh()
+	go func() {
+		<-idle
+		close(s.done)
+	}()
+}
+
+// Done returns a channel that is closed once the session is closed and all of its jobs are finished.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait blocks until the session has no unfinished jobs or ctx is done.
+func (s *Session) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.jobs.idleCh():
+		return nil
+	}
+}
+
+// Jobs returns description of all unfinished jobs of the session ordered by their id.
+func (s *Session) Jobs() []JobInfo {
+	return s.jobs.list()
+}
+
+// BudgetReport returns the current consumption of the session budgets.
+func (s *Session) BudgetReport() BudgetReport {
+	return s.budget.report()
+}
+
+// register creates the jobs of the urls unless the session is closed.
+func (s *Session) register(ctx context.Context, urls []string, analyzer analytics.Analyzer) ([]scrapeTarget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrSessionClosed
+	}
+	return s.scrapper.newTargets(ctx, s, urls, analyzer), nil
+}
+
+// inScope reports whether the url belongs to the session.
+func (s *Session) inScope(url string) bool {
+	return s.scope == nil || s.scope(url)
+}
+
+// deadline returns the eviction deadline of the url scraped now.
+// In the refresh mode the url is evicted once its refresh interval passes.
+func (s *Session) deadline(url string) time.Time {
+	if s.refresh != nil {
+		return time.Now().Add(s.refresh.interval(url))
+	}
+	if s.eviction == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(s.eviction)
+}
@@ -0,0 +1,82 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSessions checks that sessions have their own scope, seen urls and headers, while sharing the workers.
+func TestSessions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Session")))
+	}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(2)
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	first := scrapper.NewSession(SessionConfig{
+		Name:    "first",
+		Headers: http.Header{"X-Session": []string{"first"}},
+		Scope:   func(url string) bool { return !strings.HasSuffix(url, "/private") },
+	})
+	second := scrapper.NewSession(SessionConfig{
+		Name:    "second",
+		Headers: http.Header{"X-Session": []string{"second"}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the same url is scraped once by each of the sessions
+	for _, session := range []*Session{first, second} {
+		handle, err := session.ScrapeContext(ctx, server.URL+"/page", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handle.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if handle.Status() != JobDone || handle.Page().Body != session.Name() {
+			t.Fatalf("unexpected job outcome. status %v, body %q", handle.Status(), handle.Page().Body)
+		}
+
+		handle, err = session.ScrapeContext(ctx, server.URL+"/page", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handle.Wait(ctx)
+		if !errors.Is(handle.Err(), ErrDuplicate) {
+			t.Fatalf("unexpected error. got %v, want %v", handle.Err(), ErrDuplicate)
+		}
+	}
+
+	handle, err := first.ScrapeContext(ctx, server.URL+"/private", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle.Wait(ctx)
+	if handle.Status() != JobDropped || !errors.Is(handle.Err(), ErrOutOfScope) {
+		t.Fatalf("unexpected job outcome. status %v, err %v", handle.Status(), handle.Err())
+	}
+
+	// completion signal
+	first.Close()
+	if _, err := first.ScrapeContext(ctx, server.URL+"/other", nil); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("unexpected error. got %v, want %v", err, ErrSessionClosed)
+	}
+	select {
+	case <-first.Done():
+	case <-ctx.Done():
+		t.Fatal("session not done")
+	}
+	if err := second.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,130 @@
+package simhash
+
+import "sync"
+
+// Match is a fingerprint of the index near the looked up one.
+type Match struct {
+	URL      string
+	Distance int
+}
+
+// band is a slice of the bits of fingerprints, identified by its position.
+type band struct {
+	index int
+	bits  uint64
+}
+
+// Index finds the fingerprints within the Hamming distance threshold of a fingerprint.
+// The fingerprints are split into threshold+1 bands. Fingerprints within the threshold differ in at most threshold
+// bits, so they share at least one band, and only the fingerprints sharing a band have to be compared.
+type Index struct {
+	threshold int
+	masks     []uint64 // masks of the bands
+
+	mu           sync.Mutex // mutex protecting fields below
+	fingerprints map[string]uint64
+	bands        map[band]map[string]struct{}
+}
+
+// NewIndex creates an index matching the fingerprints differing in at most threshold bits.
+func NewIndex(threshold int) *Index {
+	threshold = max(0, min(threshold, 63))
+	idx := &Index{
+		threshold:    threshold,
+		fingerprints: make(map[string]uint64),
+		bands:        make(map[band]map[string]struct{}),
+	}
+	count := threshold + 1
+	start := 0
+	for i := 0; i < count; i++ {
+		width := 64 / count
+		if i < 64%count {
+			width++
+		}
+		var mask uint64
+		for bit := start; bit < start+width; bit++ {
+			mask |= 1 << bit
+		}
+		idx.masks = append(idx.masks, mask)
+		start += width
+	}
+	return idx
+}
+
+// Threshold returns the maximum Hamming distance of the matched fingerprints.
+func (idx *Index) Threshold() int { return idx.threshold }
+
+// Add adds the fingerprint of the url, replacing its previous fingerprint.
+func (idx *Index) Add(url string, fingerprint uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.add(url, fingerprint)
+}
+
+// Nearest returns the nearest fingerprint within the threshold, other than the one of the url itself.
+// Ties are resolved by the url.
+func (idx *Index) Nearest(url string, fingerprint uint64) (Match, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.nearest(url, fingerprint)
+}
+
+// Observe returns the nearest fingerprint within the threshold like Nearest. If there isn't any,
+// the fingerprint of the url is added to the index.
+func (idx *Index) Observe(url string, fingerprint uint64) (Match, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if match, ok := idx.nearest(url, fingerprint); ok {
+		return match, true
+	}
+	idx.add(url, fingerprint)
+	return Match{}, false
+}
+
+// Len returns the amount of fingerprints in the index.
+func (idx *Index) Len() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return len(idx.fingerprints)
+}
+
+func (idx *Index) add(url string, fingerprint uint64) {
+	if previous, ok := idx.fingerprints[url]; ok {
+		for i, mask := range idx.masks {
+			key := band{index: i, bits: previous & mask}
+			delete(idx.bands[key], url)
+			if len(idx.bands[key]) == 0 {
+				delete(idx.bands, key)
+			}
+		}
+	}
+	idx.fingerprints[url] = fingerprint
+	for i, mask := range idx.masks {
+		key := band{index: i, bits: fingerprint & mask}
+		urls, ok := idx.bands[key]
+		if !ok {
+			urls = make(map[string]struct{})
+			idx.bands[key] = urls
+		}
+		urls[url] = struct{}{}
+	}
+}
+
+func (idx *Index) nearest(url string, fingerprint uint64) (Match, bool) {
+	best, found := Match{}, false
+	for i, mask := range idx.masks {
+		for candidate := range idx.bands[band{index: i, bits: fingerprint & mask}] {
+			if candidate == url {
+				continue
+			}
+			distance := Distance(fingerprint, idx.fingerprints[candidate])
+			if distance > idx.threshold {
+				continue
+			}
+			if !found || distance < best.Distance || (distance == best.Distance && candidate < best.URL) {
+				best, found = Match{URL: candidate, Distance: distance}, true
+			}
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,48 @@
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// ShingleSize is the amount of consecutive words hashed together into a single feature of the text.
+const ShingleSize = 3
+
+// Fingerprint returns the 64 bit SimHash of the text. Texts sharing most of their word shingles have fingerprints
+// differing in few bits, regardless of the case and punctuation. Text without words has zero fingerprint.
+func Fingerprint(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+	var weights [64]int
+	size := min(ShingleSize, len(words))
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		feature := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if feature&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// Distance returns the Hamming distance of the fingerprints.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
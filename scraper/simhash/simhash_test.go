@@ -0,0 +1,71 @@
+package simhash
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const article = `The quick brown fox jumps over the lazy dog while the farmer watches from the porch.
+Later that evening the fox returns to the barn looking for chickens, but the dog is awake and barks loudly.
+The farmer grabs a lantern and walks outside to see what caused all the noise in the middle of the night.`
+
+func TestFingerprint(t *testing.T) {
+	if Fingerprint("") != 0 || Fingerprint(" ,. ") != 0 {
+		t.Fatal("text without words has fingerprint")
+	}
+	if Fingerprint(article) != Fingerprint(strings.ToUpper(strings.ReplaceAll(article, ",", " ; "))) {
+		t.Fatal("case and punctuation changed the fingerprint")
+	}
+	// printer-friendly variant with an extra footer
+	variant := article + " Print this page."
+	if d := Distance(Fingerprint(article), Fingerprint(variant)); d > 6 {
+		t.Fatalf("near duplicates too far, distance %d", d)
+	}
+	other := "Stock markets closed higher on Friday as investors weighed the latest inflation figures and central bank comments about interest rates."
+	if d := Distance(Fingerprint(article), Fingerprint(other)); d < 12 {
+		t.Fatalf("different texts too near, distance %d", d)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := NewIndex(3)
+	base := uint64(0xdeadbeefcafebabe)
+	idx.Add("a", base)
+	idx.Add("b", base^0b111<<40)
+	idx.Add("c", base^0xffff)
+
+	match, ok := idx.Nearest("x", base^1)
+	if !ok || match.URL != "a" || match.Distance != 1 {
+		t.Fatalf("unexpected match %+v", match)
+	}
+	// the url itself isn't matched
+	if match, ok := idx.Nearest("a", base); !ok || match.URL != "b" || match.Distance != 3 {
+		t.Fatalf("unexpected match %+v", match)
+	}
+	if _, ok := idx.Nearest("x", ^base); ok {
+		t.Fatal("unexpected match")
+	}
+
+	// replacing the fingerprint removes the old one
+	idx.Add("a", ^base)
+	if match, ok := idx.Nearest("x", base); !ok || match.URL != "b" {
+		t.Fatalf("unexpected match %+v", match)
+	}
+	if match, ok := idx.Observe("y", base^0xfff7); !ok || match.URL != "c" {
+		t.Fatalf("unexpected match %+v", match)
+	}
+	if _, ok := idx.Observe("z", 0); ok || idx.Len() != 4 {
+		t.Fatalf("fingerprint not added, len %d", idx.Len())
+	}
+
+	// every fingerprint within the threshold is found, whatever bits differ
+	idx = NewIndex(5)
+	idx.Add("a", 0)
+	for i := 0; i < 64-5; i++ {
+		fingerprint := uint64(0b11111) << i
+		if _, ok := idx.Nearest(fmt.Sprint(i), fingerprint); !ok {
+			t.Fatalf("fingerprint %b not matched", fingerprint)
+		}
+	}
+}
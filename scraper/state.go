@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+// Snapshot is a point in time view of the scrapper crawl state.
+// It holds everything that is required to continue an interrupted crawl.
+type Snapshot struct {
+	SavedAt  time.Time   `json:"savedAt"`
+	Frontier []string    `json:"frontier"` // targets waiting for execution, including the ones waiting for retry
+	InFlight []string    `json:"inFlight"` // targets that were being scraped at the time of the snapshot
+	Seen     []SeenEntry `json:"seen"`     // already scraped targets
+	// LastRuns are the times of the last runs of the scheduled jobs by their name, saved by the scheduler.
+	LastRuns map[string]time.Time `json:"lastRuns,omitempty"`
+}
+
+// SeenEntry represents a single already scraped url together with the time after which it can be rescraped.
+// Zero deadline means that the url can't be rescraped.
+type SeenEntry struct {
+	URL      string    `json:"url"`
+	Deadline time.Time `json:"deadline,omitempty"`
+}
+
+// Pending returns the urls that still have to be scraped in order to finish the crawl.
+func (s Snapshot) Pending() []string {
+	pending := make([]string, 0, len(s.Frontier)+len(s.InFlight))
+	pending = append(pending, s.InFlight...)
+	pending = append(pending, s.Frontier...)
+	return pending
+}
+
+// StateStore is an interface for persisting the crawl state between the runs.
+type StateStore interface {
+	// Save persists the snapshot, replacing the previous one.
+	Save(Snapshot) error
+	// Load returns the last saved snapshot.
+	Load() (Snapshot, error)
+}
+
+// FileStateStore is a StateStore that keeps the snapshot as a json file on the disk.
+type FileStateStore struct {
+	path string
+}
+
+// NewFileStateStore returns StateStore that saves snapshots to the file under the path.
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+// Implements StateStore.Save
+// The snapshot is written atomically, so that a crash during the save doesn't corrupt the previous snapshot.
+func (f *FileStateStore) Save(snapshot Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// writeFileAtomic writes the data to a temporary file first and then renames it to the path,
+// so that a crash during the write doesn't corrupt the previous content.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Implements StateStore.Load
+// Returns error satisfying errors.Is(err, os.ErrNotExist) if nothing was saved yet.
+func (f *FileStateStore) Load() (Snapshot, error) {
+	var snapshot Snapshot
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return snapshot, err
+	}
+	err = json.Unmarshal(data, &snapshot)
+	return snapshot, err
+}
+
+// resumeState holds the snapshot that the event loop should continue from.
+type resumeState struct {
+	snapshot Snapshot
+	factory  func(url string) analytics.Analyzer
+}
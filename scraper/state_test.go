@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Exca-DK/webscraper/scraper/analytics"
+)
+
+type memoryStateStore struct {
+	saved chan Snapshot
+}
+
+func (m *memoryStateStore) Save(snapshot Snapshot) error {
+	m.saved <- snapshot
+	return nil
+}
+
+func (m *memoryStateStore) Load() (Snapshot, error) {
+	return Snapshot{}, os.ErrNotExist
+}
+
+// TestFileStateStore checks that the snapshot survives the round trip through the disk.
+func TestFileStateStore(t *testing.T) {
+	store := NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if _, err := store.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error on empty store. got %v, want %v", err, os.ErrNotExist)
+	}
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+	snapshot := Snapshot{
+		Frontier: []string{"http://foo"},
+		InFlight: []string{"http://bar"},
+		Seen:     []SeenEntry{{URL: "http://bar"}, {URL: "http://baz", Deadline: deadline}},
+	}
+	if err := store.Save(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Pending()) != 2 || loaded.Pending()[0] != "http://bar" || loaded.Pending()[1] != "http://foo" {
+		t.Fatalf("unexpected pending urls. got %v", loaded.Pending())
+	}
+	if len(loaded.Seen) != 2 || !loaded.Seen[1].Deadline.Equal(deadline) || !loaded.Seen[0].Deadline.IsZero() {
+		t.Fatalf("unexpected seen urls. got %v", loaded.Seen)
+	}
+}
+
+// TestResume checks that the resumed scrapper scrapes pending and in-flight urls, including the pending ones
+// already seen, eg. waiting for a retry, skips the other seen ones and checkpoints the restored state.
+func TestResume(t *testing.T) {
+	requested := make(chan string, 4)
+	server := newTestServer(func() []byte { return []byte("<p>foo</p>") }, func() {})
+	defer server.Close()
+
+	seen := server.URL + "/seen"
+	pending := server.URL + "/pending"
+	inFlight := server.URL + "/inflight"
+	retried := server.URL + "/retried"
+	snapshot := Snapshot{
+		Frontier: []string{pending, retried},
+		InFlight: []string{inFlight},
+		Seen:     []SeenEntry{{URL: seen}, {URL: inFlight}, {URL: retried}},
+	}
+
+	store := &memoryStateStore{saved: make(chan Snapshot, 1)}
+	scrapper := NewScrapper(nil).WithThreads(1).WithStateStore(store, 0)
+	scrapper.Resume(snapshot, func(url string) analytics.Analyzer {
+		analyzer := &testingCallbackAnalyzer{}
+		analyzer.callback = func() {
+			// seen url is dropped as a duplicate
+			if analyzer.err == nil {
+				requested <- url
+			}
+		}
+		return analyzer
+	})
+	scrapper.Start()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case url := <-requested:
+			if url == seen {
+				t.Fatal("already seen url scraped again")
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("resumed urls not scraped")
+		}
+	}
+	scrapper.Stop()
+
+	saved := <-store.saved
+	if len(saved.Seen) != 4 {
+		t.Fatalf("unexpected seen urls in checkpoint. got %v", saved.Seen)
+	}
+}
+
+// TestInterruptedCheckpoint checks that the url whose fetch was cancelled by Stop is saved as in-flight.
+func TestInterruptedCheckpoint(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	store := &memoryStateStore{saved: make(chan Snapshot, 1)}
+	scrapper := NewScrapper(nil).WithThreads(1).WithStateStore(store, 0)
+	scrapper.Start()
+	url := server.URL + "/hanging"
+	if _, err := scrapper.Scrape(url, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch not started")
+	}
+	scrapper.Stop()
+
+	saved := <-store.saved
+	if len(saved.InFlight) != 1 || saved.InFlight[0] != url {
+		t.Fatalf("interrupted url not saved as in-flight. got %+v", saved)
+	}
+}
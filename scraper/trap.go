@@ -0,0 +1,251 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ErrTrap is the error of targets dropped because their url looks like a crawler trap.
+var ErrTrap = errors.New("crawler trap")
+
+// TrapConfig configures the heuristics detecting crawler traps, eg. calendars, faceted search or session ids in urls,
+// which produce infinite url spaces. Zero value of a limit disables its heuristic.
+type TrapConfig struct {
+	MaxSegmentRepeats int // occurrences of the same path segment, eg. /a/b/a/b/a/b
+	MaxDepth          int // path segments
+	MaxQueryParams    int // query parameters
+	MaxPatternPages   int // pages admitted per path pattern, with numbers and ids generalized and the query ignored
+	MaxFamilyPages    int // pages admitted per url family, urls differing only in their numbers and ids
+}
+
+// DefaultTrapConfig is the trap detection used by the cli.
+var DefaultTrapConfig = TrapConfig{
+	MaxSegmentRepeats: 3,
+	MaxDepth:          16,
+	MaxQueryParams:    8,
+	MaxPatternPages:   1000,
+	MaxFamilyPages:    200,
+}
+
+// Trap is a detected crawler trap. Urls matching its pattern are dropped.
+type Trap struct {
+	Pattern    string    // blocked pattern
+	Reason     string    // heuristic detecting the trap
+	URL        string    // url the trap was detected with
+	DetectedAt time.Time // time of the detection
+}
+
+// trapDetector detects crawler traps among the targets of the scrapper and blocks their patterns.
+type trapDetector struct {
+	cfg TrapConfig
+
+	mu       sync.Mutex // mutex protecting fields below
+	patterns map[string]int
+	families map[string]int
+	blocked  map[string]Trap
+}
+
+func newTrapDetector(cfg TrapConfig) *trapDetector {
+	return &trapDetector{
+		cfg:      cfg,
+		patterns: make(map[string]int),
+		families: make(map[string]int),
+		blocked:  make(map[string]Trap),
+	}
+}
+
+// check returns the trap the url falls into, if any. Detected traps are blocked and the bool reports whether
+// the trap was detected by this call.
+func (d *trapDetector) check(rawURL string) (Trap, bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Trap{}, false, nil
+	}
+	pattern, family := urlPatterns(u)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if trap, ok := d.blocked[pattern]; ok {
+		return trap, false, fmt.Errorf("%w: %s", ErrTrap, trap.Reason)
+	}
+	if trap, ok := d.blocked[family]; ok {
+		return trap, false, fmt.Errorf("%w: %s", ErrTrap, trap.Reason)
+	}
+
+	blocked, reason := family, ""
+	segments := pathSegments(u)
+	switch {
+	case d.cfg.MaxSegmentRepeats > 0 && maxRepeats(segments) > d.cfg.MaxSegmentRepeats:
+		reason = fmt.Sprintf("path segment repeated more than %d times", d.cfg.MaxSegmentRepeats)
+	case d.cfg.MaxDepth > 0 && len(segments) > d.cfg.MaxDepth:
+		reason = fmt.Sprintf("path deeper than %d", d.cfg.MaxDepth)
+	case d.cfg.MaxQueryParams > 0 && queryParams(u) > d.cfg.MaxQueryParams:
+		reason = fmt.Sprintf("more than %d query parameters", d.cfg.MaxQueryParams)
+	case d.cfg.MaxFamilyPages > 0 && d.families[family] >= d.cfg.MaxFamilyPages:
+		reason = fmt.Sprintf("more than %d urls differing only in numbers", d.cfg.MaxFamilyPages)
+	case d.cfg.MaxPatternPages > 0 && d.patterns[pattern] >= d.cfg.MaxPatternPages:
+		blocked, reason = pattern, fmt.Sprintf("more than %d pages of the path pattern", d.cfg.MaxPatternPages)
+	default:
+		return Trap{}, false, nil
+	}
+	trap := Trap{Pattern: blocked, Reason: reason, URL: rawURL, DetectedAt: time.Now()}
+	d.blocked[blocked] = trap
+	return trap, true, fmt.Errorf("%w: %s", ErrTrap, reason)
+}
+
+// admit counts the url admitted for scraping towards the page caps of its patterns.
+func (d *trapDetector) admit(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	pattern, family := urlPatterns(u)
+	d.mu.Lock()
+	d.patterns[pattern]++
+	d.families[family]++
+	d.mu.Unlock()
+}
+
+// traps returns the detected traps sorted by their pattern.
+func (d *trapDetector) traps() []Trap {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	traps := make([]Trap, 0, len(d.blocked))
+	for _, trap := range d.blocked {
+		traps = append(traps, trap)
+	}
+	sort.Slice(traps, func(i, j int) bool { return traps[i].Pattern < traps[j].Pattern })
+	return traps
+}
+
+// WithTrapDetection enables detection of crawler traps. Targets falling into a trap are dropped with ErrTrap.
+// Detection is disabled by default.
+func (s *Scrapper) WithTrapDetection(cfg TrapConfig) *Scrapper {
+	s.traps = newTrapDetector(cfg)
+	return s
+}
+
+// Traps returns the crawler traps detected so far, sorted by their pattern.
+func (s *Scrapper) Traps() []Trap {
+	if s.traps == nil {
+		return nil
+	}
+	return s.traps.traps()
+}
+
+// checkTrap returns the error the target should be dropped with if it falls into a crawler trap. Revisits aren't checked.
+func (s *Scrapper) checkTrap(target scrapeTarget) error {
+	if s.traps == nil || target.revisit {
+		return nil
+	}
+	trap, detected, err := s.traps.check(target.url)
+	if detected {
+		s.logger.Warn("detected crawler trap", "pattern:", trap.Pattern, "reason:", trap.Reason, "url:", trap.URL)
+	}
+	return err
+}
+
+// urlPatterns returns the path pattern and the family of the url. The path pattern is the host and the path
+// with the numbers and ids generalized, the family additionally includes the query with generalized values.
+func urlPatterns(u *url.URL) (pattern, family string) {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(u.Host))
+	for _, segment := range pathSegments(u) {
+		b.WriteByte('/')
+		b.WriteString(generalize(segment))
+	}
+	pattern = b.String()
+
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i == 0 {
+			b.WriteByte('?')
+		} else {
+			b.WriteByte('&')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(generalize(strings.Join(query[key], ",")))
+	}
+	return pattern, b.String()
+}
+
+// generalize replaces the token by {id} if it looks like an identifier, eg. a session id or a hash,
+// otherwise its runs of digits are replaced by {n}.
+func generalize(token string) string {
+	if isID(token) {
+		return "{id}"
+	}
+	var b strings.Builder
+	digits := false
+	for _, r := range token {
+		if unicode.IsDigit(r) {
+			if !digits {
+				b.WriteString("{n}")
+			}
+			digits = true
+			continue
+		}
+		digits = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// isID reports whether the token is a long mix of letters and digits.
+func isID(token string) bool {
+	if len(token) < 16 {
+		return false
+	}
+	var letters, digits bool
+	for _, r := range token {
+		switch {
+		case unicode.IsDigit(r):
+			digits = true
+		case unicode.IsLetter(r):
+			letters = true
+		case r != '-' && r != '_':
+			return false
+		}
+	}
+	return letters && digits
+}
+
+// pathSegments returns the non-empty segments of the path of the url. Path parameters, eg. ;jsessionid=, are cut off.
+func pathSegments(u *url.URL) []string {
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	for i, segment := range segments {
+		segments[i], _, _ = strings.Cut(segment, ";")
+	}
+	return segments
+}
+
+// maxRepeats returns the highest amount of occurrences of a single segment.
+func maxRepeats(segments []string) int {
+	counts := make(map[string]int, len(segments))
+	highest := 0
+	for _, segment := range segments {
+		counts[segment]++
+		highest = max(highest, counts[segment])
+	}
+	return highest
+}
+
+func queryParams(u *url.URL) int {
+	params := 0
+	for _, values := range u.Query() {
+		params += len(values)
+	}
+	return params
+}
@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTrapDetector(t *testing.T) {
+	d := newTrapDetector(TrapConfig{MaxSegmentRepeats: 2, MaxDepth: 5, MaxQueryParams: 3, MaxPatternPages: 4, MaxFamilyPages: 2})
+	visit := func(url string) error {
+		_, _, err := d.check(url)
+		if err == nil {
+			d.admit(url)
+		}
+		return err
+	}
+
+	for _, url := range []string{
+		"https://example.com/a/b/a/b/a/b",
+		"https://example.com/1/2/3/4/5/6",
+		"https://example.com/search?a=1&b=2&c=3&c=4",
+	} {
+		if err := visit(url); !errors.Is(err, ErrTrap) {
+			t.Fatalf("trap of %v not detected", url)
+		}
+	}
+	if err := visit("https://example.com/a/b/a/c?x=1"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// urls differing only in numbers
+	for i := 1; i <= 2; i++ {
+		if err := visit(fmt.Sprintf("https://example.com/calendar/2024/%d?view=day-%d", i, i)); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if err := visit("https://example.com/calendar/2025/1?view=day-1"); !errors.Is(err, ErrTrap) {
+		t.Fatal("numeric family not detected")
+	}
+	// session ids are generalized as well
+	u, _ := url.Parse("https://example.com/s/0a1b2c3d4e5f6a7b8c9d/page;jsessionid=1")
+	if pattern, _ := urlPatterns(u); pattern != "example.com/s/{id}/page" {
+		t.Fatalf("unexpected pattern %v", pattern)
+	}
+
+	// faceted search, the query is ignored by the path pattern
+	for _, color := range []string{"red", "blue"} {
+		if err := visit("https://example.com/calendar/2024/3?color=" + color); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if err := visit("https://example.com/calendar/2024/3?color=green"); !errors.Is(err, ErrTrap) {
+		t.Fatal("path pattern cap not detected")
+	}
+	// the pattern is blocked, even for the urls of other families
+	if err := visit("https://example.com/calendar/1999/9"); !errors.Is(err, ErrTrap) {
+		t.Fatal("pattern not blocked")
+	}
+	if err := visit("https://example.com/calendar"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	traps := d.traps()
+	if len(traps) != 5 || traps[len(traps)-1].Pattern != "example.com/{n}/{n}/{n}/{n}/{n}/{n}" {
+		t.Fatalf("unexpected traps %+v", traps)
+	}
+}
+
+func TestTrapDetection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	scrapper := NewScrapper(nil).WithThreads(4).WithTrapDetection(TrapConfig{MaxFamilyPages: 3})
+	scrapper.Start()
+	defer scrapper.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	urls := make([]string, 5)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%v/page?id=%d", server.URL, i)
+	}
+	handles, err := scrapper.ScrapeMultiContext(ctx, urls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, handle := range handles {
+		handle.Wait(ctx)
+		if i < 3 && handle.Status() != JobDone {
+			t.Fatalf("unexpected status of %v: %v, err %v", handle.URL(), handle.Status(), handle.Err())
+		}
+		if i >= 3 && (handle.Status() != JobDropped || !errors.Is(handle.Err(), ErrTrap)) {
+			t.Fatalf("trap %v not dropped. status %v, err %v", handle.URL(), handle.Status(), handle.Err())
+		}
+	}
+	if traps := scrapper.Traps(); len(traps) != 1 || traps[0].URL != urls[3] {
+		t.Fatalf("unexpected traps %+v", traps)
+	}
+}
@@ -27,9 +27,12 @@ type WorkPool struct {
 	workersFeed chan<- JobStats
 	workersIn   chan Worker
 	done        chan struct{}
+	wake        chan struct{} // wakes up the monitor when a worker finishes or the pool is resized
 
-	mu      sync.Mutex // mutex protecting workers
-	workers []Worker   // workers
+	mu      sync.Mutex       // mutex protecting workers, running and size
+	workers []Worker         // workers waiting for execution
+	running []*runningWorker // workers being executed, in the order of spawning
+	size    int              // workers added and not yet dropped, retiring or finished, including the ones on their way to the monitor
 
 	wg sync.WaitGroup
 }
@@ -41,6 +44,7 @@ func NewWorkPool(feedCh chan<- JobStats) *WorkPool {
 		target:      uint32(gos),
 		workersIn:   make(chan Worker),
 		done:        make(chan struct{}),
+		wake:        make(chan struct{}, 1),
 		workersFeed: feedCh,
 	}
 }
@@ -60,16 +64,65 @@ func (p *WorkPool) Start(ctx context.Context) {
 }
 
 func (p *WorkPool) spawnWorker(ctx context.Context, worker Worker) {
+	rw := &runningWorker{retire: make(chan struct{})}
+	p.mu.Lock()
+	p.running = append(p.running, rw)
+	p.mu.Unlock()
 	atomic.AddUint32(&p.activeWorkers, 1)
 	go func() {
-		result := worker.Run(ctx)
+		result := worker.Run(context.WithValue(ctx, retireKey{}, (<-chan struct{})(rw.retire)))
+		p.removeRunning(rw)
 		atomic.AddUint32(&p.activeWorkers, ^uint32(0))
 		atomic.AddUint32(&p.finishedWorkers, 1)
 		p.workersFeed <- result
 		p.wg.Done()
+		p.notify()
 	}()
 }
 
+// spawnPending spawns pending workers until the target is reached.
+func (p *WorkPool) spawnPending(ctx context.Context) {
+	for p.PendingWorkers() != 0 {
+		active := atomic.LoadUint32(&p.activeWorkers)
+		if active >= atomic.LoadUint32(&p.target) {
+			return
+		}
+		p.spawnWorker(ctx, p.popWorker())
+	}
+}
+
+func (p *WorkPool) removeRunning(rw *runningWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// retiring workers were already discounted
+	if !rw.retiring {
+		p.size--
+	}
+	for i, w := range p.running {
+		if w == rw {
+			p.running = append(p.running[:i], p.running[i+1:]...)
+			return
+		}
+	}
+}
+
+// dropPending removes all pending workers and returns their amount.
+func (p *WorkPool) dropPending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dropped := len(p.workers)
+	p.workers = p.workers[:0]
+	p.size -= dropped
+	return dropped
+}
+
+func (p *WorkPool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
 func (p *WorkPool) popWorker() Worker {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -91,37 +144,37 @@ func (p *WorkPool) addWorker(w Worker) {
 
 func (p *WorkPool) monitor(ctx context.Context) {
 	workerTicker := time.NewTicker(3 * time.Second)
+	defer workerTicker.Stop()
 	for {
-		active := atomic.LoadUint32(&p.activeWorkers)
-		if active < p.target && p.PendingWorkers() > 0 {
-			p.spawnWorker(ctx, p.popWorker())
-		}
+		p.spawnPending(ctx)
 
 		select {
 		case <-ctx.Done():
 			close(p.done)
+			// pending workers will never run
+			p.wg.Add(-p.dropPending())
 			p.wg.Wait()
 			close(p.workersFeed)
 			return
 		case w := <-p.workersIn:
 			p.wg.Add(1)
 			p.addWorker(w)
+		case <-p.wake:
 		case <-workerTicker.C:
-			for p.PendingWorkers() != 0 {
-				active := atomic.LoadUint32(&p.activeWorkers)
-				if active >= p.target {
-					break
-				}
-				p.spawnWorker(ctx, p.popWorker())
-			}
 		}
 	}
 }
 
 // AddWorker adds a new worker to the WorkPool for task execution.
 func (p *WorkPool) AddWorker(w Worker) {
+	p.mu.Lock()
+	p.size++
+	p.mu.Unlock()
 	select {
 	case <-p.done:
+		p.mu.Lock()
+		p.size--
+		p.mu.Unlock()
 	case p.workersIn <- w:
 	}
 }
@@ -143,6 +196,53 @@ func (p *WorkPool) PendingWorkers() int {
 	return len(p.workers)
 }
 
+// Resize changes the number of worker threads while the pool is running.
+// When growing, pending workers are started right away. When shrinking, surplus pending workers are dropped
+// and surplus running workers are asked to retire. Retiring workers are still counted as running until their job
+// observes the Retiring signal and returns, so the job they are executing is never interrupted.
+// It returns how many workers have to be added in order to have 'threads' workers that are not retiring.
+// Workers added by AddWorker count right away, so that resizing again before they reach the pool doesn't ask for more.
+func (p *WorkPool) Resize(threads uint32) int {
+	if threads == 0 {
+		threads++
+	}
+	atomic.StoreUint32(&p.target, threads)
+
+	p.mu.Lock()
+	surplus := p.size - int(threads)
+	// pending workers haven't started anything yet, so they go first
+	dropped := 0
+	for ; surplus > 0 && len(p.workers) > 0; surplus-- {
+		p.workers = p.workers[:len(p.workers)-1]
+		dropped++
+		p.size--
+	}
+	// retire the most recently spawned workers
+	for i := len(p.running) - 1; surplus > 0 && i >= 0; i-- {
+		rw := p.running[i]
+		if rw.retiring {
+			continue
+		}
+		rw.retiring = true
+		close(rw.retire)
+		surplus--
+		p.size--
+	}
+	p.mu.Unlock()
+
+	p.wg.Add(-dropped)
+	p.notify()
+	if surplus < 0 {
+		return -surplus
+	}
+	return 0
+}
+
+// Threads returns the configured number of worker threads.
+func (p *WorkPool) Threads() int {
+	return int(atomic.LoadUint32(&p.target))
+}
+
 // WithThreads configures the number of worker threads for the WorkPool.
 // It allows you to specify the desired number of worker threads to be utilized
 // for concurrent task execution. If the provided 'threads' count is zero, it will
@@ -154,3 +254,19 @@ func (p *WorkPool) WithThreads(threads uint32) *WorkPool {
 	atomic.StoreUint32(&p.target, threads)
 	return p
 }
+
+// runningWorker keeps the retirement signal of a worker being executed.
+type runningWorker struct {
+	retire   chan struct{}
+	retiring bool
+}
+
+type retireKey struct{}
+
+// Retiring returns a channel that is closed when the pool asks the worker executing the job to retire.
+// Long running jobs should observe it between units of work and return once it's closed.
+// Returns nil channel if the ctx doesn't belong to a pool worker.
+func Retiring(ctx context.Context) <-chan struct{} {
+	ch, _ := ctx.Value(retireKey{}).(<-chan struct{})
+	return ch
+}
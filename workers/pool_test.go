@@ -94,3 +94,61 @@ func TestPool(t *testing.T) {
 		}
 	})
 }
+
+func TestPoolResize(t *testing.T) {
+	var (
+		ch      = make(chan JobStats)
+		started = make(chan struct{}, 4)
+		// runs until asked to retire
+		retiringWorker = NewWorker(Job{exec: func(ctx context.Context, id string) error {
+			started <- struct{}{}
+			select {
+			case <-ctx.Done():
+			case <-Retiring(ctx):
+			}
+			return nil
+		}, description: "test"})
+	)
+
+	pool := NewWorkPool(ch).WithThreads(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx)
+
+	// grow, all of the workers should run concurrently
+	if missing := pool.Resize(3); missing != 3 {
+		t.Fatalf("unexpected missing workers. expected: %v, got %v", 3, missing)
+	}
+	for i := 0; i < 3; i++ {
+		pool.AddWorker(retiringWorker)
+	}
+	// added workers count even before they start
+	if missing := pool.Resize(3); missing != 0 {
+		t.Fatalf("unexpected missing workers after repeated resize. expected: %v, got %v", 0, missing)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("worker not started after resize")
+		}
+	}
+
+	// shrink, surplus workers should retire
+	if missing := pool.Resize(1); missing != 0 {
+		t.Fatalf("unexpected missing workers. expected: %v, got %v", 0, missing)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatal("worker not retired after resize")
+		}
+	}
+	if running := pool.RunningWorkers(); running != 1 {
+		t.Fatalf("unexpected running workers. expected: %v, got %v", 1, running)
+	}
+	if missing := pool.Resize(2); missing != 1 {
+		t.Fatalf("unexpected missing workers. expected: %v, got %v", 1, missing)
+	}
+}